@@ -0,0 +1,228 @@
+package rollingwriter
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock give out the time to the writer, its scheduler and the rotation
+// policies
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is the time.Timer of a Clock
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Ticker is the time.Ticker of a Clock
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// clock returns the configured clock, the system clock by default
+func (c *Config) clock() Clock {
+	if c.Clock != nil {
+		return c.Clock
+	}
+	return systemClock{}
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type systemTimer struct {
+	*time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time { return t.Timer.C }
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time { return t.Ticker.C }
+
+// FakeClock is a Clock which only moves when told to, the timers and
+// tickers fire as their time is reached by Advance or Set
+type FakeClock struct {
+	now     time.Time
+	timers  []*fakeTimer
+	waiters []fakeWaiter
+	lock    sync.Mutex
+}
+
+type fakeWaiter struct {
+	n    int
+	done chan struct{}
+}
+
+// NewFakeClock generate the FakeClock set at the given time
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the time of the clock
+func (f *FakeClock) Now() time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.now
+}
+
+// NewTimer returns a timer firing once the clock reached d from now
+func (f *FakeClock) NewTimer(d time.Duration) Timer {
+	return f.add(d, 0)
+}
+
+// NewTicker returns a ticker firing every d of the clock
+func (f *FakeClock) NewTicker(d time.Duration) Ticker {
+	return fakeTicker{f.add(d, d)}
+}
+
+func (f *FakeClock) add(d, period time.Duration) *fakeTimer {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	t := &fakeTimer{clock: f, c: make(chan time.Time, 1), at: f.now.Add(d), period: period, active: true}
+	f.timers = append(f.timers, t)
+	f.notify()
+	return t
+}
+
+// BlockUntil waits until n timers and tickers are waiting on the clock,
+// i.e. the go routines using them are ready for the clock to be advanced
+func (f *FakeClock) BlockUntil(n int) {
+	f.lock.Lock()
+	w := fakeWaiter{n: n, done: make(chan struct{})}
+	f.waiters = append(f.waiters, w)
+	f.notify()
+	f.lock.Unlock()
+	<-w.done
+}
+
+// notify releases the BlockUntil callers, must be called with the lock
+// held
+func (f *FakeClock) notify() {
+	active := 0
+	for _, t := range f.timers {
+		if t.active {
+			active++
+		}
+	}
+	waiters := f.waiters[:0]
+	for _, w := range f.waiters {
+		if active >= w.n {
+			close(w.done)
+		} else {
+			waiters = append(waiters, w)
+		}
+	}
+	f.waiters = waiters
+}
+
+// Advance moves the clock forward, firing the timers and tickers in the
+// order of their time. Like time.Ticker, a ticker drops the ticks its
+// receiver is not ready for
+func (f *FakeClock) Advance(d time.Duration) {
+	f.Set(f.Now().Add(d))
+}
+
+// Set moves the clock to the given time, see Advance
+func (f *FakeClock) Set(now time.Time) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for {
+		var next *fakeTimer
+		for _, t := range f.timers {
+			if t.active && !t.at.After(now) && (next == nil || t.at.Before(next.at)) {
+				next = t
+			}
+		}
+		if next == nil {
+			break
+		}
+
+		if next.at.After(f.now) {
+			f.now = next.at
+		}
+		select {
+		case next.c <- f.now:
+		default:
+		}
+		if next.period > 0 {
+			next.at = next.at.Add(next.period)
+		} else {
+			next.active = false
+			f.remove(next)
+		}
+	}
+	if now.After(f.now) {
+		f.now = now
+	}
+}
+
+type fakeTimer struct {
+	clock  *FakeClock
+	c      chan time.Time
+	at     time.Time
+	period time.Duration
+	active bool
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+
+	active := t.active
+	t.active = false
+	t.clock.remove(t)
+	return active
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+
+	active := t.active
+	if !active {
+		t.clock.timers = append(t.clock.timers, t)
+	}
+	t.at = t.clock.now.Add(d)
+	t.active = true
+	t.clock.notify()
+	return active
+}
+
+type fakeTicker struct {
+	*fakeTimer
+}
+
+func (t fakeTicker) Stop() { t.fakeTimer.Stop() }
+
+// remove drops a stopped timer, must be called with the lock held
+func (f *FakeClock) remove(t *fakeTimer) {
+	for i, timer := range f.timers {
+		if timer == t {
+			f.timers = append(f.timers[:i], f.timers[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package rollingwriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	timer := clock.NewTimer(time.Minute)
+	ticker := clock.NewTicker(time.Second)
+
+	// the ticks the receiver is not ready for are dropped
+	clock.Advance(30 * time.Second)
+	assert.Equal(t, start.Add(time.Second), <-ticker.C())
+	assert.Equal(t, 0, len(ticker.C()))
+	assert.Equal(t, 0, len(timer.C()))
+
+	clock.Advance(30 * time.Second)
+	assert.Equal(t, start.Add(time.Minute), <-timer.C())
+	assert.False(t, timer.Stop())
+
+	// a reset timer fires again
+	assert.False(t, timer.Reset(time.Minute))
+	clock.BlockUntil(2)
+	ticker.Stop()
+	<-ticker.C()
+	clock.Set(start.Add(time.Hour))
+	assert.Equal(t, start.Add(2*time.Minute), <-timer.C())
+	assert.Equal(t, 0, len(ticker.C()))
+	assert.Equal(t, start.Add(time.Hour), clock.Now())
+}
@@ -0,0 +1,77 @@
+package rollingwriter
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// eventHub delivers the rotation events to the subscribers without ever
+// blocking the writer go routine
+type eventHub struct {
+	subs    map[int]chan RotationEvent
+	nextID  int
+	closed  bool
+	dropped atomic.Uint64
+	lock    sync.Mutex
+}
+
+func (h *eventHub) subscribe(size int) (<-chan RotationEvent, func()) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	ch := make(chan RotationEvent, size)
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if h.subs == nil {
+		h.subs = make(map[int]chan RotationEvent)
+	}
+	h.nextID++
+	id := h.nextID
+	h.subs[id] = ch
+
+	return ch, func() {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		if sub, ok := h.subs[id]; ok {
+			delete(h.subs, id)
+			close(sub)
+		}
+	}
+}
+
+// publish sends the event to every subscriber with room in its channel,
+// the event is dropped for the others
+func (h *eventHub) publish(event RotationEvent) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for _, ch := range h.subs {
+		select {
+		case ch <- event:
+		default:
+			h.dropped.Add(1)
+		}
+	}
+}
+
+// close closes the channels of all the subscribers
+func (h *eventHub) close() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.closed = true
+	for id, ch := range h.subs {
+		delete(h.subs, id)
+		close(ch)
+	}
+}
+
+// Subscribe returns a channel receiving the events of the completed
+// rotations. The writer never waits for a subscriber, the events which do
+// not fit in the channel buffer of the given size are dropped. The channel
+// is closed when cancel is called or the writer is closed
+func (w *Writer) Subscribe(size int) (events <-chan RotationEvent, cancel func()) {
+	return w.events.subscribe(size)
+}
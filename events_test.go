@@ -0,0 +1,56 @@
+package rollingwriter
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotationEvents(t *testing.T) {
+	writer := newWriter()
+	events, cancel := writer.Subscribe(1)
+	others, _ := writer.Subscribe(0)
+
+	writer.Write([]byte("hello\n"))
+	writer.Sync()
+	writer.monitor.(*manager).fire(RotationSignal)
+
+	var event RotationEvent
+	select {
+	case event = <-events:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no rotation event")
+	}
+	assert.Equal(t, RotationSignal, event.Reason)
+	assert.Equal(t, "signal", event.Reason.String())
+	assert.Equal(t, int64(6), event.Bytes)
+	assert.False(t, event.EndTime.Before(event.StartTime))
+	assert.False(t, event.EndTime.Before(event.TriggeredAt))
+	b, _ := os.ReadFile(event.BackupPath)
+	assert.Equal(t, "hello\n", string(b))
+
+	// the unbuffered subscriber missed the event
+	assert.Equal(t, 0, len(others))
+	assert.True(t, writer.events.dropped.Load() > 0)
+
+	cancel()
+	_, ok := <-events
+	assert.False(t, ok)
+	writer.Close()
+	_, ok = <-others
+	assert.False(t, ok)
+	os.Remove(event.BackupPath)
+	clean()
+}
+
+func TestManagerFire(t *testing.T) {
+	m, _ := newManager(&Config{}, nil)
+	m.fire(RotationManual)
+	// a pending request is not blocking the manager
+	m.fire(RotationSize)
+	trigger := <-m.Triggers()
+	assert.Equal(t, RotationManual, trigger.Reason)
+	m.Close()
+}
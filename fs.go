@@ -0,0 +1,551 @@
+package rollingwriter
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// File is an open file of a FileSystem
+type File interface {
+	io.Reader
+	io.Writer
+	io.Seeker
+	io.Closer
+	Stat() (os.FileInfo, error)
+	Sync() error
+}
+
+// FileSystem give out the file operations of the writer, the compression
+// and the retention, the os file system by default
+type FileSystem interface {
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+	MkdirAll(path string, perm os.FileMode) error
+	Stat(name string) (os.FileInfo, error)
+	ReadDir(name string) ([]os.DirEntry, error)
+}
+
+// fs returns the configured file system, the os file system by default
+func (c *Config) fs() FileSystem {
+	if c.FileSystem != nil {
+		return c.FileSystem
+	}
+	return osFS{}
+}
+
+type osFS struct{}
+
+func (osFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	file, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		// a nil *os.File must not be returned as a non nil File
+		return nil, err
+	}
+	return file, nil
+}
+
+func (osFS) Rename(oldpath, newpath string) error { return os.Rename(oldpath, newpath) }
+
+func (osFS) Remove(name string) error { return os.Remove(name) }
+
+func (osFS) MkdirAll(path string, perm os.FileMode) error { return os.MkdirAll(path, perm) }
+
+func (osFS) Stat(name string) (os.FileInfo, error) { return os.Stat(name) }
+
+func (osFS) ReadDir(name string) ([]os.DirEntry, error) { return os.ReadDir(name) }
+
+// MemFS is an in-memory FileSystem. Like on unix, the open files of a
+// renamed or removed file keep working on its data
+type MemFS struct {
+	files map[string]*memNode
+	dirs  map[string]*memNode
+	lock  sync.Mutex
+}
+
+type memNode struct {
+	data    []byte
+	mode    os.FileMode
+	modTime time.Time
+}
+
+// NewMemFS generate the empty MemFS, only the root directory exists
+func NewMemFS() *MemFS {
+	return &MemFS{
+		files: make(map[string]*memNode),
+		dirs:  make(map[string]*memNode),
+	}
+}
+
+// memPath returns the absolute path of name, relative paths are resolved
+// against the working directory as on the os file system
+func memPath(name string) string {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return filepath.Clean(name)
+	}
+	return abs
+}
+
+// isDir reports whether the path is a directory, must be called with the
+// lock held
+func (m *MemFS) isDir(p string) bool {
+	_, ok := m.dirs[p]
+	return ok || filepath.Dir(p) == p
+}
+
+// OpenFile opens the file with the os.OpenFile flags
+func (m *MemFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	p := memPath(name)
+	if m.isDir(p) {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	}
+	node, ok := m.files[p]
+	switch {
+	case ok && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, &os.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case ok:
+		if flag&os.O_TRUNC != 0 {
+			node.data = nil
+			node.modTime = time.Now()
+		}
+	case flag&os.O_CREATE == 0 || !m.isDir(filepath.Dir(p)):
+		return nil, &os.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	default:
+		node = &memNode{mode: perm, modTime: time.Now()}
+		m.files[p] = node
+	}
+	return &memFile{fs: m, name: name, node: node, flag: flag}, nil
+}
+
+// Rename moves the file, replacing the new path if it is a file
+func (m *MemFS) Rename(oldpath, newpath string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	oldp, newp := memPath(oldpath), memPath(newpath)
+	node, ok := m.files[oldp]
+	switch {
+	case !ok && m.isDir(oldp):
+		// directories are not renamed by the writer
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EINVAL}
+	case !ok || !m.isDir(filepath.Dir(newp)):
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrNotExist}
+	case m.isDir(newp):
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EISDIR}
+	}
+	delete(m.files, oldp)
+	m.files[newp] = node
+	return nil
+}
+
+// Remove removes the file or the empty directory
+func (m *MemFS) Remove(name string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	p := memPath(name)
+	if _, ok := m.files[p]; ok {
+		delete(m.files, p)
+		return nil
+	}
+	if _, ok := m.dirs[p]; !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	if len(m.children(p)) > 0 {
+		return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+	}
+	delete(m.dirs, p)
+	return nil
+}
+
+// MkdirAll creates the directory and its missing parents
+func (m *MemFS) MkdirAll(path string, perm os.FileMode) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for p := memPath(path); !m.isDir(p); p = filepath.Dir(p) {
+		if _, ok := m.files[p]; ok {
+			return &os.PathError{Op: "mkdir", Path: path, Err: syscall.ENOTDIR}
+		}
+		m.dirs[p] = &memNode{mode: perm | os.ModeDir, modTime: time.Now()}
+	}
+	return nil
+}
+
+// Stat returns the file info of the file or directory
+func (m *MemFS) Stat(name string) (os.FileInfo, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	p := memPath(name)
+	if node, ok := m.files[p]; ok {
+		return node.info(filepath.Base(p)), nil
+	}
+	if m.isDir(p) {
+		return m.dirInfo(p), nil
+	}
+	return nil, &os.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+// ReadDir returns the entries of the directory sorted by name
+func (m *MemFS) ReadDir(name string) ([]os.DirEntry, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	p := memPath(name)
+	if !m.isDir(p) {
+		return nil, &os.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	var entries []os.DirEntry
+	for _, child := range m.children(p) {
+		if node, ok := m.files[child]; ok {
+			entries = append(entries, fs.FileInfoToDirEntry(node.info(filepath.Base(child))))
+		} else {
+			entries = append(entries, fs.FileInfoToDirEntry(m.dirInfo(child)))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// ReadFile returns the content of the file
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	node, ok := m.files[memPath(name)]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return append([]byte(nil), node.data...), nil
+}
+
+// children returns the files and directories in the directory, must be
+// called with the lock held
+func (m *MemFS) children(dir string) []string {
+	var children []string
+	for p := range m.files {
+		if filepath.Dir(p) == dir {
+			children = append(children, p)
+		}
+	}
+	for p := range m.dirs {
+		if p != dir && filepath.Dir(p) == dir {
+			children = append(children, p)
+		}
+	}
+	return children
+}
+
+func (m *MemFS) dirInfo(p string) os.FileInfo {
+	node, ok := m.dirs[p]
+	if !ok {
+		node = &memNode{mode: os.ModeDir | DefaultDirMode}
+	}
+	return node.info(filepath.Base(p))
+}
+
+func (n *memNode) info(name string) os.FileInfo {
+	return &memInfo{name: name, size: int64(len(n.data)), mode: n.mode, modTime: n.modTime}
+}
+
+type memInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (i *memInfo) Name() string       { return i.name }
+func (i *memInfo) Size() int64        { return i.size }
+func (i *memInfo) Mode() os.FileMode  { return i.mode }
+func (i *memInfo) ModTime() time.Time { return i.modTime }
+func (i *memInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *memInfo) Sys() any           { return nil }
+
+// memFile is an open file of a MemFS
+type memFile struct {
+	fs     *MemFS
+	name   string
+	node   *memNode
+	offset int64
+	flag   int
+	closed bool
+}
+
+func (f *memFile) Read(b []byte) (int, error) {
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+
+	if err := f.check("read", f.flag&os.O_WRONLY == 0); err != nil {
+		return 0, err
+	}
+	if f.offset >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(b, f.node.data[f.offset:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *memFile) Write(b []byte) (int, error) {
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+
+	if err := f.check("write", f.flag&(os.O_WRONLY|os.O_RDWR) != 0); err != nil {
+		return 0, err
+	}
+	if f.flag&os.O_APPEND != 0 {
+		f.offset = int64(len(f.node.data))
+	}
+	if end := f.offset + int64(len(b)); end > int64(len(f.node.data)) {
+		f.node.data = append(f.node.data, make([]byte, end-int64(len(f.node.data)))...)
+	}
+	copy(f.node.data[f.offset:], b)
+	f.offset += int64(len(b))
+	f.node.modTime = time.Now()
+	return len(b), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+
+	if err := f.check("seek", true); err != nil {
+		return 0, err
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += int64(len(f.node.data))
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: syscall.EINVAL}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+
+	if err := f.check("stat", true); err != nil {
+		return nil, err
+	}
+	return f.node.info(filepath.Base(f.name)), nil
+}
+
+func (f *memFile) Sync() error {
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+	return f.check("sync", true)
+}
+
+func (f *memFile) Close() error {
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+
+	if err := f.check("close", true); err != nil {
+		return err
+	}
+	f.closed = true
+	return nil
+}
+
+// check returns the error of the operation on a closed file or with a
+// missing access mode, must be called with the lock held
+func (f *memFile) check(op string, allowed bool) error {
+	if f.closed {
+		return &os.PathError{Op: op, Path: f.name, Err: os.ErrClosed}
+	}
+	if !allowed {
+		return &os.PathError{Op: op, Path: f.name, Err: syscall.EBADF}
+	}
+	return nil
+}
+
+// FSOp is a file system operation a FaultFS can fail
+type FSOp string
+
+// File system operations
+const (
+	OpOpen     FSOp = "open"
+	OpRename   FSOp = "rename"
+	OpRemove   FSOp = "remove"
+	OpMkdirAll FSOp = "mkdir"
+	OpStat     FSOp = "stat"
+	OpReadDir  FSOp = "readdir"
+	OpRead     FSOp = "read"
+	OpWrite    FSOp = "write"
+	OpSync     FSOp = "sync"
+	OpClose    FSOp = "close"
+)
+
+// Fault is an error injected in a FaultFS
+type Fault struct {
+	Op FSOp
+	// Path is a filepath.Match pattern of the full path or the base name
+	// of the file, an empty pattern matches any file
+	Path string
+	// Err is returned by the operation, e.g. syscall.ENOSPC
+	Err error
+	// Times the operation fails, 0 fails it until the faults are cleared
+	Times int
+}
+
+// FaultFS wraps a FileSystem and fails the operations matching the
+// injected faults, the files it opens fail their reads, writes, syncs and
+// closes too
+type FaultFS struct {
+	FileSystem
+	faults []*Fault
+	lock   sync.Mutex
+}
+
+// NewFaultFS generate the FaultFS wrapping fs
+func NewFaultFS(fs FileSystem) *FaultFS {
+	return &FaultFS{FileSystem: fs}
+}
+
+// Inject adds the fault
+func (f *FaultFS) Inject(fault Fault) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.faults = append(f.faults, &fault)
+}
+
+// Clear removes all the faults
+func (f *FaultFS) Clear() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.faults = nil
+}
+
+// fault returns the error injected for the operation on any of the files
+func (f *FaultFS) fault(op FSOp, names ...string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for i, fault := range f.faults {
+		if fault.Op != op || !fault.matches(names) {
+			continue
+		}
+		if fault.Times > 0 {
+			if fault.Times--; fault.Times == 0 {
+				f.faults = append(f.faults[:i], f.faults[i+1:]...)
+			}
+		}
+		return fault.Err
+	}
+	return nil
+}
+
+func (fault *Fault) matches(names []string) bool {
+	if fault.Path == "" {
+		return true
+	}
+	for _, name := range names {
+		if ok, _ := filepath.Match(fault.Path, name); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(fault.Path, filepath.Base(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *FaultFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if err := f.fault(OpOpen, name); err != nil {
+		return nil, &os.PathError{Op: string(OpOpen), Path: name, Err: err}
+	}
+	file, err := f.FileSystem.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &faultFile{File: file, fs: f, name: name}, nil
+}
+
+func (f *FaultFS) Rename(oldpath, newpath string) error {
+	if err := f.fault(OpRename, oldpath, newpath); err != nil {
+		return &os.LinkError{Op: string(OpRename), Old: oldpath, New: newpath, Err: err}
+	}
+	return f.FileSystem.Rename(oldpath, newpath)
+}
+
+func (f *FaultFS) Remove(name string) error {
+	if err := f.fault(OpRemove, name); err != nil {
+		return &os.PathError{Op: string(OpRemove), Path: name, Err: err}
+	}
+	return f.FileSystem.Remove(name)
+}
+
+func (f *FaultFS) MkdirAll(path string, perm os.FileMode) error {
+	if err := f.fault(OpMkdirAll, path); err != nil {
+		return &os.PathError{Op: string(OpMkdirAll), Path: path, Err: err}
+	}
+	return f.FileSystem.MkdirAll(path, perm)
+}
+
+func (f *FaultFS) Stat(name string) (os.FileInfo, error) {
+	if err := f.fault(OpStat, name); err != nil {
+		return nil, &os.PathError{Op: string(OpStat), Path: name, Err: err}
+	}
+	return f.FileSystem.Stat(name)
+}
+
+func (f *FaultFS) ReadDir(name string) ([]os.DirEntry, error) {
+	if err := f.fault(OpReadDir, name); err != nil {
+		return nil, &os.PathError{Op: string(OpReadDir), Path: name, Err: err}
+	}
+	return f.FileSystem.ReadDir(name)
+}
+
+// faultFile is a file opened by a FaultFS
+type faultFile struct {
+	File
+	fs   *FaultFS
+	name string
+}
+
+func (f *faultFile) Read(b []byte) (int, error) {
+	if err := f.fs.fault(OpRead, f.name); err != nil {
+		return 0, &os.PathError{Op: string(OpRead), Path: f.name, Err: err}
+	}
+	return f.File.Read(b)
+}
+
+func (f *faultFile) Write(b []byte) (int, error) {
+	if err := f.fs.fault(OpWrite, f.name); err != nil {
+		return 0, &os.PathError{Op: string(OpWrite), Path: f.name, Err: err}
+	}
+	return f.File.Write(b)
+}
+
+func (f *faultFile) Sync() error {
+	if err := f.fs.fault(OpSync, f.name); err != nil {
+		return &os.PathError{Op: string(OpSync), Path: f.name, Err: err}
+	}
+	return f.File.Sync()
+}
+
+// Close closes the file even if the close fails
+func (f *faultFile) Close() error {
+	err := f.File.Close()
+	if errF := f.fs.fault(OpClose, f.name); errF != nil {
+		return &os.PathError{Op: string(OpClose), Path: f.name, Err: errF}
+	}
+	return err
+}
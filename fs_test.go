@@ -0,0 +1,111 @@
+package rollingwriter
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemFS(t *testing.T) {
+	mem := NewMemFS()
+	_, err := mem.OpenFile("/logs/app.log", DefaultFileFlag, 0644)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	assert.Nil(t, mem.MkdirAll("/logs/old", 0700))
+	file, err := mem.OpenFile("/logs/app.log", DefaultFileFlag, 0644)
+	assert.Nil(t, err)
+	file.Write([]byte("hello "))
+	file.Seek(0, io.SeekStart)
+	file.Write([]byte("world\n"))
+
+	// the open file follows the rename
+	assert.Nil(t, mem.Rename("/logs/app.log", "/logs/old/app.log.1"))
+	file.Write([]byte("again\n"))
+	b, _ := mem.ReadFile("/logs/old/app.log.1")
+	assert.Equal(t, "hello world\nagain\n", string(b))
+	_, err = mem.Stat("/logs/app.log")
+	assert.True(t, os.IsNotExist(err))
+	info, _ := file.Stat()
+	assert.Equal(t, int64(18), info.Size())
+
+	file.Seek(0, io.SeekStart)
+	b, _ = io.ReadAll(file)
+	assert.Equal(t, "hello world\nagain\n", string(b))
+	assert.Nil(t, file.Close())
+	_, err = file.Write([]byte("closed\n"))
+	assert.True(t, errors.Is(err, os.ErrClosed))
+
+	entries, _ := mem.ReadDir("/logs")
+	assert.Equal(t, 1, len(entries))
+	assert.True(t, entries[0].IsDir())
+	assert.True(t, errors.Is(mem.Remove("/logs/old"), syscall.ENOTEMPTY))
+	assert.Nil(t, mem.Remove("/logs/old/app.log.1"))
+	assert.Nil(t, mem.Remove("/logs/old"))
+	assert.True(t, os.IsNotExist(mem.Remove("/logs/old")))
+
+	// the relative paths are resolved against the working directory
+	mem.MkdirAll("test", 0700)
+	file, _ = mem.OpenFile("./test/app.log", os.O_CREATE|os.O_WRONLY, 0644)
+	file.Write([]byte("relative\n"))
+	b, _ = mem.ReadFile("test/../test/app.log")
+	assert.Equal(t, "relative\n", string(b))
+	_, err = file.Read(b)
+	assert.True(t, errors.Is(err, syscall.EBADF))
+}
+
+func TestFaultFS(t *testing.T) {
+	mem := NewMemFS()
+	faults := NewFaultFS(mem)
+	faults.Inject(Fault{Op: OpMkdirAll, Err: syscall.EACCES, Times: 1})
+	assert.True(t, errors.Is(faults.MkdirAll("/logs", 0700), syscall.EACCES))
+	assert.Nil(t, faults.MkdirAll("/logs", 0700))
+
+	// the faults match the base name or the full path
+	faults.Inject(Fault{Op: OpWrite, Path: "*.log", Err: syscall.ENOSPC})
+	faults.Inject(Fault{Op: OpRename, Path: "/logs/backup/*", Err: syscall.EXDEV})
+	file, _ := faults.OpenFile("/logs/app.log", DefaultFileFlag, 0644)
+	other, _ := faults.OpenFile("/logs/app.txt", DefaultFileFlag, 0644)
+	_, err := file.Write([]byte("hello\n"))
+	assert.True(t, errors.Is(err, syscall.ENOSPC))
+	_, err = other.Write([]byte("hello\n"))
+	assert.Nil(t, err)
+	err = faults.Rename("/logs/app.txt", "/logs/backup/app.txt")
+	assert.True(t, errors.Is(err, syscall.EXDEV))
+
+	faults.Clear()
+	_, err = file.Write([]byte("hello\n"))
+	assert.Nil(t, err)
+	b, _ := mem.ReadFile("/logs/app.log")
+	assert.Equal(t, "hello\n", string(b))
+
+	// a failed close still closes the file
+	faults.Inject(Fault{Op: OpClose, Err: syscall.EIO})
+	assert.True(t, errors.Is(file.Close(), syscall.EIO))
+	_, err = file.Write([]byte("hello\n"))
+	assert.True(t, errors.Is(err, os.ErrClosed))
+}
+
+func TestNewWriterFaults(t *testing.T) {
+	faults := NewFaultFS(NewMemFS())
+
+	// the constructor returns the file system errors
+	for _, fault := range []Fault{
+		{Op: OpMkdirAll, Err: syscall.EACCES},
+		{Op: OpOpen, Path: "app.log", Err: syscall.ENOSPC},
+	} {
+		faults.Clear()
+		faults.Inject(fault)
+		w, err := NewWriter(WithFilePath("/logs/app.log"), WithFileSystem(faults))
+		assert.Nil(t, w, fault.Op)
+		assert.True(t, errors.Is(err, fault.Err), fault.Op)
+	}
+
+	faults.Clear()
+	w, err := NewWriter(WithFilePath("/logs/app.log"), WithFileSystem(faults))
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+}
@@ -0,0 +1,194 @@
+package rollingwriter
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// NewLogger generate a *log.Logger writing to a rolling writer with the
+// given config, prefix and flag are the same as log.New. The returned
+// writer must be closed to flush the logs
+func NewLogger(c *Config, prefix string, flag int) (*log.Logger, RollingWriter, error) {
+	w, err := NewWriterFromConfig(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	// log.Logger reuses its buffer once Write returns
+	return log.New(&copyWriter{w: w}, prefix, flag), w, nil
+}
+
+// SyslogFormat give out the syslog header format
+type SyslogFormat int
+
+// Syslog formats
+const (
+	// RFC5424 is the format of the current syslog protocol
+	RFC5424 SyslogFormat = iota
+	// RFC3164 is the legacy BSD syslog format
+	RFC3164
+)
+
+// Syslog severities, the lower the more severe
+const (
+	SeverityEmergency = iota
+	SeverityAlert
+	SeverityCritical
+	SeverityError
+	SeverityWarning
+	SeverityNotice
+	SeverityInfo
+	SeverityDebug
+)
+
+// Syslog facilities
+const (
+	FacilityKernel = iota
+	FacilityUser
+	FacilityMail
+	FacilityDaemon
+	FacilityAuth
+	FacilitySyslog
+	FacilityLocal0 = iota + 10
+	FacilityLocal1
+	FacilityLocal2
+	FacilityLocal3
+	FacilityLocal4
+	FacilityLocal5
+	FacilityLocal6
+	FacilityLocal7
+)
+
+// header field limits of RFC 3164 TAG and RFC 5424 APP-NAME
+const (
+	maxTagLen     = 32
+	maxAppNameLen = 48
+)
+
+// SyslogConfig give out the header fields of a SyslogWriter
+type SyslogConfig struct {
+	Format   SyslogFormat `json:"format,omitempty"`
+	Facility int          `json:"facility,omitempty"`
+	// Severity of the records written with Write
+	Severity int `json:"severity,omitempty"`
+	// Hostname defaults to os.Hostname
+	Hostname string `json:"hostname,omitempty"`
+	// AppName defaults to the program name, it is cut to the characters
+	// allowed by the format: 32 alphanumerics for RFC 3164, 48 printable
+	// ASCII for RFC 5424
+	AppName string `json:"app_name,omitempty"`
+}
+
+// SyslogWriter prefixes every record with a syslog header before writing
+// it to the underlying writer
+type SyslogWriter struct {
+	w    io.Writer
+	conf SyslogConfig
+	pid  string
+}
+
+// NewSyslogWriter generate the SyslogWriter writing to w, the facility
+// must be in 0-23
+func NewSyslogWriter(w io.Writer, c SyslogConfig) (*SyslogWriter, error) {
+	if c.Facility < FacilityKernel || c.Facility > FacilityLocal7 {
+		return nil, fmt.Errorf("%w: syslog facility %d", ErrInvalidArgument, c.Facility)
+	}
+	if c.Hostname == "" {
+		c.Hostname, _ = os.Hostname()
+	}
+	if c.AppName == "" && len(os.Args) > 0 {
+		c.AppName = filepath.Base(os.Args[0])
+	}
+	if c.Format == RFC3164 {
+		c.AppName = headerField(c.AppName, maxTagLen, isAlphanumeric)
+	} else {
+		c.AppName = headerField(c.AppName, maxAppNameLen, isPrintASCII)
+	}
+	return &SyslogWriter{w: w, conf: c, pid: strconv.Itoa(os.Getpid())}, nil
+}
+
+// Write writes the record with the configured severity
+func (s *SyslogWriter) Write(b []byte) (int, error) {
+	return s.WriteSeverity(s.conf.Severity, b)
+}
+
+// WriteSeverity writes the record with the given severity, the record is
+// copied so b can be reused once it returns
+func (s *SyslogWriter) WriteSeverity(severity int, b []byte) (int, error) {
+	now := time.Now()
+	pri := s.conf.Facility*8 + severity&7
+
+	line := make([]byte, 0, len(b)+len(s.conf.Hostname)+len(s.conf.AppName)+64)
+	line = append(line, '<')
+	line = strconv.AppendInt(line, int64(pri), 10)
+	line = append(line, '>')
+	switch s.conf.Format {
+	case RFC3164:
+		line = now.AppendFormat(line, time.Stamp)
+		line = append(line, ' ')
+		line = append(line, s.conf.Hostname...)
+		line = append(line, ' ')
+		line = append(line, s.conf.AppName...)
+		line = append(line, '[')
+		line = append(line, s.pid...)
+		line = append(line, "]: "...)
+	default:
+		line = append(line, "1 "...)
+		line = now.AppendFormat(line, "2006-01-02T15:04:05.000000Z07:00")
+		line = append(line, ' ')
+		line = append(line, nilValue(s.conf.Hostname)...)
+		line = append(line, ' ')
+		line = append(line, nilValue(s.conf.AppName)...)
+		line = append(line, ' ')
+		line = append(line, s.pid...)
+		line = append(line, " - - "...)
+	}
+	line = append(line, b...)
+	if len(b) == 0 || b[len(b)-1] != '\n' {
+		line = append(line, '\n')
+	}
+
+	if _, err := s.w.Write(line); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close closes the underlying writer if it is an io.Closer
+func (s *SyslogWriter) Close() error {
+	if c, ok := s.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// headerField keeps the first n characters of v accepted by ok
+func headerField(v string, n int, ok func(c byte) bool) string {
+	b := make([]byte, 0, min(len(v), n))
+	for i := 0; i < len(v) && len(b) < n; i++ {
+		if ok(v[i]) {
+			b = append(b, v[i])
+		}
+	}
+	return string(b)
+}
+
+func isAlphanumeric(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+func isPrintASCII(c byte) bool {
+	return 33 <= c && c <= 126
+}
+
+// nilValue returns the RFC 5424 NILVALUE for empty header fields
+func nilValue(v string) string {
+	if v == "" {
+		return "-"
+	}
+	return v
+}
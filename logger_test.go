@@ -0,0 +1,73 @@
+package rollingwriter
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLogger(t *testing.T) {
+	cfg := NewDefaultConfig()
+	cfg.FilePath = "./test/logger.log"
+	logger, w, err := NewLogger(&cfg, "app: ", 0)
+	assert.Nil(t, err)
+	for i := range 100 {
+		logger.Println("hello", i)
+	}
+	w.Close()
+
+	b, _ := os.ReadFile(cfg.FilePath)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	assert.Equal(t, 100, len(lines))
+	for i, line := range lines {
+		assert.Equal(t, "app: hello "+strconv.Itoa(i), line)
+	}
+	os.Remove(cfg.FilePath)
+	clean()
+}
+
+func TestSyslogWriter(t *testing.T) {
+	var out bytes.Buffer
+	pid := strconv.Itoa(os.Getpid())
+
+	s, err := NewSyslogWriter(&out, SyslogConfig{
+		Facility: FacilityLocal0, Severity: SeverityInfo, Hostname: "host", AppName: "app",
+	})
+	assert.Nil(t, err)
+	n, err := s.Write([]byte("hello\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, 6, n)
+	assert.Regexp(t, regexp.MustCompile(`^<134>1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}\S+ host app `+pid+` - - hello\n$`), out.String())
+
+	out.Reset()
+	s, err = NewSyslogWriter(&out, SyslogConfig{Format: RFC3164, Facility: FacilityAuth, Hostname: "host", AppName: "app"})
+	assert.Nil(t, err)
+	s.WriteSeverity(SeverityError, []byte("failed"))
+	assert.Regexp(t, regexp.MustCompile(`^<35>\w{3} [ \d]\d \d\d:\d\d:\d\d host app\[`+pid+`\]: failed\n$`), out.String())
+}
+
+func TestSyslogWriterConfig(t *testing.T) {
+	for _, facility := range []int{-1, 24} {
+		s, err := NewSyslogWriter(io.Discard, SyslogConfig{Facility: facility})
+		assert.Nil(t, s)
+		assert.ErrorIs(t, err, ErrInvalidArgument)
+	}
+
+	s, err := NewSyslogWriter(io.Discard, SyslogConfig{Facility: FacilityLocal7})
+	assert.Nil(t, err)
+	assert.Equal(t, headerField(filepath.Base(os.Args[0]), maxAppNameLen, isPrintASCII), s.conf.AppName)
+	assert.NotContains(t, s.conf.AppName, "/")
+
+	long := strings.Repeat("a-b ", 20)
+	s, _ = NewSyslogWriter(io.Discard, SyslogConfig{Format: RFC3164, AppName: long})
+	assert.Equal(t, strings.Repeat("ab", 16), s.conf.AppName)
+	s, _ = NewSyslogWriter(io.Discard, SyslogConfig{Format: RFC5424, AppName: long})
+	assert.Equal(t, strings.Repeat("a-b", 16), s.conf.AppName)
+}
@@ -2,33 +2,47 @@ package rollingwriter
 
 import (
 	"os"
+	"os/signal"
 	"path"
 	"strconv"
 	"strings"
-	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/robfig/cron"
 )
 
 type manager struct {
-	thresholdSize    int64
-	startAt          time.Time
-	cr               *cron.Cron
-	rotationEventsCh chan string
-	doneCh           chan bool
-	wg               sync.WaitGroup
-	lock             sync.Mutex
+	thresholdSize int64
+	clock         Clock
+	sched         *scheduler
+	ownSched      bool
+	jobID         int
+	checking      atomic.Bool
+	triggerCh     chan RotationTrigger
+	signalCh      chan os.Signal
+	policy        RotationPolicy
+	doneCh        chan bool
 }
 
 // NewManager generate the Manager with config
 func NewManager(c *Config) (FileMonitor, error) {
+	return newManager(c, nil)
+}
+
+// newManager generate the Manager with config, scheduling its jobs on the
+// given scheduler. A private scheduler is started if sched is nil
+func newManager(c *Config, sched *scheduler) (*manager, error) {
+	clock := c.clock()
+	if sched != nil && sched.clock != clock {
+		// the shared scheduler runs on another clock
+		sched = nil
+	}
 	m := &manager{
-		startAt:          time.Now(),
-		cr:               cron.New(),
-		rotationEventsCh: make(chan string),
-		doneCh:           make(chan bool),
-		wg:               sync.WaitGroup{},
+		clock:     clock,
+		sched:     sched,
+		triggerCh: make(chan RotationTrigger, 1),
+		doneCh:    make(chan bool),
 	}
 
 	// start the manager according to policy
@@ -36,56 +50,102 @@ func NewManager(c *Config) (FileMonitor, error) {
 	default:
 		fallthrough
 	case WithoutRolling:
-		return m, nil
+	case RecordRolling:
+		// the records are counted by the writer go routine
 	case TimeRolling:
-		if err := m.cr.AddFunc(c.RollingTimePattern, func() {
-			m.rotationEventsCh <- m.GenNewBackupFileName(c)
-		}); err != nil {
+		spec, err := timeSchedule(c)
+		if err != nil {
 			return nil, err
 		}
-		m.cr.Start()
+		schedule := inLocation(spec, c.location())
+		m.startScheduler()
+		m.jobID = m.sched.schedule(schedule, func() {
+			m.fire(RotationTime)
+		})
 	case VolumeRolling:
 		m.ParseVolume(c)
-		go func() {
-			timer := time.NewTicker(time.Duration(Precision) * time.Second)
-			defer timer.Stop()
+		m.startScheduler()
+		m.jobID = m.sched.schedule(cron.Every(time.Duration(Precision)*time.Second), func() {
+			// skip the check while a previous one is still running
+			if !m.checking.CompareAndSwap(false, true) {
+				return
+			}
+			defer m.checking.Store(false)
 
-			var file *os.File
-			var err error
+			if info, err := c.fs().Stat(c.FilePath); err == nil && info.Size() > m.thresholdSize {
+				m.fire(RotationSize)
+			}
+			// check if you need to prune backups
+		})
+	}
 
+	if len(c.RotateSignals) > 0 {
+		m.signalCh = make(chan os.Signal, 1)
+		signal.Notify(m.signalCh, c.RotateSignals...)
+		go func() {
 			for {
 				select {
 				case <-m.doneCh:
 					return
-				case <-timer.C:
-					if file, err = os.Open(c.FilePath); err != nil {
-						continue
-					}
-					if info, err := file.Stat(); err == nil && info.Size() > m.thresholdSize {
-						m.rotationEventsCh <- m.GenNewBackupFileName(c)
-					}
-					file.Close()
-					// check if you need to prune backups
+				case <-m.signalCh:
+					m.fire(RotationSignal)
 				}
 			}
 		}()
 	}
+
+	if c.RotationPolicy != nil {
+		m.policy = c.RotationPolicy
+		m.policy.Start(m.clock, m.fire)
+	}
 	return m, nil
 }
 
-// RotationEvents returns a channel that provides new backup filenames when rotation events occur
-func (m *manager) RotationEvents() chan string {
-	return m.rotationEventsCh
+func (m *manager) startScheduler() {
+	if m.sched == nil {
+		m.sched = newScheduler(m.clock)
+		m.ownSched = true
+	}
+}
+
+// fire requests a rotation unless one is already pending
+func (m *manager) fire(reason RotationReason) {
+	select {
+	case m.triggerCh <- RotationTrigger{Reason: reason, At: m.clock.Now()}:
+	default:
+	}
+}
+
+// Triggers returns the channel on which the manager requests rotations
+func (m *manager) Triggers() <-chan RotationTrigger {
+	return m.triggerCh
 }
 
 // Close stop the manager and returns
 func (m *manager) Close() {
 	close(m.doneCh)
-	m.cr.Stop()
+	if m.signalCh != nil {
+		signal.Stop(m.signalCh)
+	}
+	if m.policy != nil {
+		m.policy.Stop()
+	}
+	if m.sched == nil {
+		return
+	}
+	m.sched.remove(m.jobID)
+	if m.ownSched {
+		m.sched.stop()
+	}
 }
 
 // ParseVolume parse the config volume format and return threshold
 func (m *manager) ParseVolume(c *Config) {
+	m.thresholdSize = volumeThreshold(c)
+}
+
+// volumeThreshold returns the VolumeRolling threshold size of the config
+func volumeThreshold(c *Config) int64 {
 	s := []byte(strings.ToUpper(c.RollingVolumeSize))
 	if !strings.Contains(string(s), "K") && !strings.Contains(string(s), "KB") &&
 		!strings.Contains(string(s), "M") && !strings.Contains(string(s), "MB") &&
@@ -93,8 +153,7 @@ func (m *manager) ParseVolume(c *Config) {
 		!strings.Contains(string(s), "T") && !strings.Contains(string(s), "TB") {
 
 		// set the default threshold with 1GB
-		m.thresholdSize = 1024 * 1024 * 1024
-		return
+		return 1024 * 1024 * 1024
 	}
 
 	var unit int64 = 1
@@ -121,18 +180,27 @@ func (m *manager) ParseVolume(c *Config) {
 	case "K", "KB":
 		unit *= 1024
 	}
-	m.thresholdSize = int64(p) * unit
+	return int64(p) * unit
 }
 
-// GenNewBackupFileName generates a new backup file
-func (m *manager) GenNewBackupFileName(c *Config) string {
-	m.lock.Lock()
-	defer func() {
-		m.startAt = time.Now()
-		m.lock.Unlock()
-	}()
+// backupFileName returns the backup file name of the log file started at
+// the given time
+func backupFileName(c *Config, startAt time.Time) string {
+	// interval backups are named by the period they cover
+	if interval, err := parseInterval(c.RollingInterval); err == nil && c.RollingPolicy == TimeRolling {
+		startAt = periodStart(startAt, interval, c.location())
+	}
+	return backupPath(c, formatTimeTag(c, startAt))
+}
+
+// formatTimeTag formats the time with TimeTagFormat in the configured
+// location
+func formatTimeTag(c *Config, t time.Time) string {
+	return t.In(c.location()).Format(c.TimeTagFormat)
+}
 
-	timeTag := m.startAt.Format(c.TimeTagFormat)
+// backupPath returns the backup file name with the given time tag
+func backupPath(c *Config, timeTag string) string {
 	if c.Compress {
 		return path.Join(c.FilePath + ".gz." + timeTag)
 	}
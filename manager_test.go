@@ -51,19 +51,17 @@ func TestParseVolume(t *testing.T) {
 }
 
 func TestGenLogFileName(t *testing.T) {
-	m := manager{}
 	c := &Config{
-		FilePath:       "./file.log",
+		FilePath:      "./file.log",
 		TimeTagFormat: "200601021504",
 	}
-	m.startAt = time.Now()
+	startAt := time.Now()
 
-	dest := m.GenNewBackupFileName(c)
-	timetag := m.startAt.Format(c.TimeTagFormat)
+	dest := backupFileName(c, startAt)
+	timetag := startAt.Format(c.TimeTagFormat)
 	assert.Equal(t, path.Join("./", "file"+".log."+timetag), dest)
 
 	c.Compress = true
-	dest = m.GenNewBackupFileName(c)
-	timetag = m.startAt.Format(c.TimeTagFormat)
+	dest = backupFileName(c, startAt)
 	assert.Equal(t, path.Join("./", "file"+".log.gz."+timetag), dest)
 }
@@ -0,0 +1,164 @@
+// Package metrics exports the stats of rolling writers as a
+// prometheus.Collector and as expvar variables, labelled by file path
+package metrics
+
+import (
+	"expvar"
+	"sync"
+
+	"github.com/nipuntalukdar/rollingwriter"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Namespace prefixes the prometheus metric names
+const Namespace = "rollingwriter"
+
+// StatsSource is a writer giving out its stats, e.g. *rollingwriter.Writer
+type StatsSource interface {
+	Stats() rollingwriter.Stats
+}
+
+// Collector collects the stats of the added writers, it is both a
+// prometheus.Collector and an expvar.Var
+type Collector struct {
+	sources map[string]StatsSource
+	lock    sync.RWMutex
+}
+
+var (
+	_ prometheus.Collector = (*Collector)(nil)
+	_ expvar.Var           = (*Collector)(nil)
+)
+
+// NewCollector generate the Collector without any writer
+func NewCollector() *Collector {
+	return &Collector{sources: make(map[string]StatsSource)}
+}
+
+// Add adds the stats of the writer of the log file path, replacing the
+// writer previously added with the same path
+func (c *Collector) Add(path string, s StatsSource) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.sources[path] = s
+}
+
+// AddWriter adds the stats of the writer labelled by its file path
+func (c *Collector) AddWriter(w *rollingwriter.Writer) {
+	c.Add(w.FilePath(), w)
+}
+
+// Remove removes the writer of the log file path
+func (c *Collector) Remove(path string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.sources, path)
+}
+
+// Publish publishes the collector as the expvar variable of the given
+// name, like expvar.Publish it panics if the name is already in use
+func (c *Collector) Publish(name string) {
+	expvar.Publish(name, c)
+}
+
+// Stats returns the stats of every writer by file path
+func (c *Collector) Stats() map[string]rollingwriter.Stats {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	stats := make(map[string]rollingwriter.Stats, len(c.sources))
+	for path, s := range c.sources {
+		stats[path] = s.Stats()
+	}
+	return stats
+}
+
+// String returns the stats of every writer by file path as JSON, for
+// expvar
+func (c *Collector) String() string {
+	return expvar.Func(func() any { return c.Stats() }).String()
+}
+
+var (
+	pathLabel = []string{"path"}
+
+	recordsDesc        = newDesc("records_total", "Records accepted by Write.")
+	bytesDesc          = newDesc("bytes_total", "Bytes accepted by Write.")
+	recordsWrittenDesc = newDesc("records_written_total", "Records taken off the queue by the writer.")
+	bytesWrittenDesc   = newDesc("bytes_written_total", "Bytes written to the log files.")
+	queueDepthDesc     = newDesc("queue_depth", "Records waiting in the queue.")
+	queueSizeDesc      = newDesc("queue_size", "Capacity of the queue.")
+	flushesDesc        = newDesc("flushes_total", "Buffer writes to the log file.")
+	directWritesDesc   = newDesc("direct_writes_total", "Records too big for the buffer written directly.")
+	rotationsDesc      = newDesc("rotations_total", "Completed rotations by reason.", "reason")
+	lastRotationDesc   = newDesc("last_rotation_timestamp_seconds", "Time the last rotation completed.")
+	rotationLagDesc    = newDesc("rotation_lag_seconds", "Delay between the trigger and the completion of the last rotation.")
+	compressionsDesc   = newDesc("compressions_total", "Compressed backups.")
+	compressionDesc    = newDesc("compression_seconds_total", "Time spent compressing backups.")
+	maxCompressionDesc = newDesc("compression_max_seconds", "Longest backup compression.")
+	commitsDesc        = newDesc("commits_total", "Flushes acknowledging synchronous writes.")
+	committedDesc      = newDesc("committed_records_total", "Records acknowledged by the commits.")
+	maxCommittedDesc   = newDesc("commit_max_records", "Largest batch of records of a commit.")
+	commitDesc         = newDesc("commit_seconds_total", "Time spent writing and syncing the commits.")
+	maxCommitDesc      = newDesc("commit_max_seconds", "Longest commit.")
+	errorsDesc         = newDesc("errors_total", "Errors by phase.", "phase")
+	droppedDesc        = newDesc("dropped_records_total", "Records lost to failed writes or left queued at close.")
+	droppedEventsDesc  = newDesc("dropped_events_total", "Rotation events a subscriber had no room for.")
+)
+
+func newDesc(name, help string, labels ...string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(Namespace, "", name), help, append(pathLabel, labels...), nil)
+}
+
+// Describe sends the descriptors of the metrics
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		recordsDesc, bytesDesc, recordsWrittenDesc, bytesWrittenDesc, queueDepthDesc, queueSizeDesc,
+		flushesDesc, directWritesDesc, rotationsDesc, lastRotationDesc, rotationLagDesc,
+		compressionsDesc, compressionDesc, maxCompressionDesc, commitsDesc, committedDesc, maxCommittedDesc,
+		commitDesc, maxCommitDesc, errorsDesc, droppedDesc, droppedEventsDesc,
+	} {
+		ch <- desc
+	}
+}
+
+// Collect sends the metrics of every writer
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for path, s := range c.Stats() {
+		counter := func(desc *prometheus.Desc, v float64, labels ...string) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, v, append([]string{path}, labels...)...)
+		}
+		gauge := func(desc *prometheus.Desc, v float64) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, path)
+		}
+
+		counter(recordsDesc, float64(s.Records))
+		counter(bytesDesc, float64(s.Bytes))
+		counter(recordsWrittenDesc, float64(s.RecordsWritten))
+		counter(bytesWrittenDesc, float64(s.BytesWritten))
+		gauge(queueDepthDesc, float64(s.QueueDepth))
+		gauge(queueSizeDesc, float64(s.QueueSize))
+		counter(flushesDesc, float64(s.Flushes))
+		counter(directWritesDesc, float64(s.DirectWrites))
+		for reason, n := range s.RotationsByReason {
+			counter(rotationsDesc, float64(n), reason)
+		}
+		if !s.LastRotation.IsZero() {
+			gauge(lastRotationDesc, float64(s.LastRotation.UnixNano())/1e9)
+		}
+		gauge(rotationLagDesc, s.RotationLag.Seconds())
+		counter(compressionsDesc, float64(s.Compressions))
+		counter(compressionDesc, s.CompressionTime.Seconds())
+		gauge(maxCompressionDesc, s.MaxCompressionTime.Seconds())
+		counter(commitsDesc, float64(s.Commits))
+		counter(committedDesc, float64(s.CommittedRecords))
+		gauge(maxCommittedDesc, float64(s.MaxCommitRecords))
+		counter(commitDesc, s.CommitTime.Seconds())
+		gauge(maxCommitDesc, s.MaxCommitTime.Seconds())
+		for phase, n := range s.ErrorsByPhase {
+			counter(errorsDesc, float64(n), phase)
+		}
+		counter(droppedDesc, float64(s.Dropped))
+		counter(droppedEventsDesc, float64(s.DroppedEvents))
+	}
+}
@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"strings"
+	"testing"
+
+	"github.com/nipuntalukdar/rollingwriter"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func newWriter(path string) *rollingwriter.Writer {
+	w, _ := rollingwriter.NewWriter(
+		rollingwriter.WithFilePath(path),
+		rollingwriter.WithFileSystem(rollingwriter.NewMemFS()),
+	)
+	return w.(*rollingwriter.Writer)
+}
+
+func TestCollector(t *testing.T) {
+	app, audit := newWriter("/logs/app.log"), newWriter("/logs/audit.log")
+	defer app.Close()
+	defer audit.Close()
+	app.Write([]byte("hello\n"))
+	app.Write([]byte("world\n"))
+	_, err := app.Rotate(context.Background())
+	assert.Nil(t, err)
+	audit.Write([]byte("hello\n"))
+	audit.Sync()
+
+	c := NewCollector()
+	c.AddWriter(app)
+	c.AddWriter(audit)
+	registry := prometheus.NewPedanticRegistry()
+	assert.Nil(t, registry.Register(c))
+
+	assert.Nil(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP rollingwriter_records_total Records accepted by Write.
+# TYPE rollingwriter_records_total counter
+rollingwriter_records_total{path="/logs/app.log"} 2
+rollingwriter_records_total{path="/logs/audit.log"} 1
+# HELP rollingwriter_bytes_written_total Bytes written to the log files.
+# TYPE rollingwriter_bytes_written_total counter
+rollingwriter_bytes_written_total{path="/logs/app.log"} 12
+rollingwriter_bytes_written_total{path="/logs/audit.log"} 6
+# HELP rollingwriter_rotations_total Completed rotations by reason.
+# TYPE rollingwriter_rotations_total counter
+rollingwriter_rotations_total{path="/logs/app.log",reason="manual"} 1
+`), "rollingwriter_records_total", "rollingwriter_bytes_written_total", "rollingwriter_rotations_total"))
+	assert.Equal(t, 1, testutil.CollectAndCount(c, "rollingwriter_last_rotation_timestamp_seconds"))
+	assert.Equal(t, 2, testutil.CollectAndCount(c, "rollingwriter_queue_size"))
+
+	c.Remove("/logs/audit.log")
+	assert.Equal(t, 1, testutil.CollectAndCount(c, "rollingwriter_queue_size"))
+}
+
+func TestExpvar(t *testing.T) {
+	app := newWriter("/logs/app.log")
+	defer app.Close()
+	app.Write([]byte("hello\n"))
+	app.Sync()
+
+	// expvar names can only be published once per process
+	c, ok := expvar.Get("rollingwriter_test").(*Collector)
+	if !ok {
+		c = NewCollector()
+		c.Publish("rollingwriter_test")
+	}
+	c.AddWriter(app)
+
+	var stats map[string]rollingwriter.Stats
+	assert.Nil(t, json.Unmarshal([]byte(expvar.Get("rollingwriter_test").String()), &stats))
+	assert.Equal(t, uint64(1), stats["/logs/app.log"].Records)
+	assert.Equal(t, uint64(6), stats["/logs/app.log"].BytesWritten)
+}
@@ -0,0 +1,71 @@
+package rollingwriter
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// everyNRecords rotates after n records
+type everyNRecords struct {
+	n       int
+	count   int
+	trigger func(RotationReason)
+	rotated []RotationEvent
+	stopped bool
+}
+
+func (p *everyNRecords) Start(clock Clock, trigger func(RotationReason)) {
+	p.trigger = trigger
+}
+
+func (p *everyNRecords) Written(n int) {
+	p.count++
+	if p.count == p.n {
+		p.trigger(RotationCustom)
+	}
+}
+
+func (p *everyNRecords) Rotated(event RotationEvent) {
+	p.count = 0
+	p.rotated = append(p.rotated, event)
+}
+
+func (p *everyNRecords) Stop() {
+	p.stopped = true
+}
+
+func TestRotationPolicy(t *testing.T) {
+	policy := &everyNRecords{n: 3}
+	cfg := NewDefaultConfig()
+	cfg.FilePath = "./test/unittest.log"
+	WithRotationPolicy(policy)(&cfg)
+	w, err := NewWriterFromConfig(&cfg)
+	assert.Nil(t, err)
+	writer := w.(*Writer)
+	events, _ := writer.Subscribe(1)
+
+	for range 3 {
+		writer.Write([]byte("hello\n"))
+	}
+	var event RotationEvent
+	select {
+	case event = <-events:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no rotation event")
+	}
+	assert.Equal(t, RotationCustom, event.Reason)
+	assert.Equal(t, int64(18), event.Bytes)
+
+	// Rotate waits for the writer go routine to be done with the event
+	backup, _ := writer.Rotate(context.Background())
+	writer.Close()
+	assert.Equal(t, 2, len(policy.rotated))
+	assert.True(t, policy.stopped)
+	os.Remove(event.BackupPath)
+	os.Remove(backup)
+	clean()
+}
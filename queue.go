@@ -0,0 +1,276 @@
+package rollingwriter
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// cacheLine is the size the hot fields are padded to, so that producers
+// writing neighbouring slots do not share cache lines
+const cacheLine = 64
+
+// byteStripes is the number of stripes of the enqueued bytes counter
+const byteStripes = 16
+
+// queue is a bounded multi producer single consumer ring buffer. A
+// producer claims a slot with a single atomic add and publishes its message
+// in the slot, the consumer takes the published messages in claim order in
+// batches. Every slot is on its own cache line, so the producers only
+// contend on the claim counter instead of the lock of a channel
+type queue struct {
+	tail  atomic.Uint64
+	_     [cacheLine - 8]byte
+	head  atomic.Uint64
+	_     [cacheLine - 8]byte
+	bytes [byteStripes]stripe
+
+	slots []slot
+	mask  uint64
+
+	// the consumer sleeps on readyCh once the queue is empty
+	sleeping atomic.Bool
+	readyCh  chan struct{}
+
+	// the producers wait on space when the queue is full, or on spaceCh
+	// which is closed and replaced when the consumer frees a slot
+	waiters atomic.Int32
+	space   *sync.Cond
+	spaceCh chan struct{}
+	lock    sync.Mutex
+
+	// the producers stop waiting once the queue is closed
+	closed atomic.Bool
+	done   chan struct{}
+}
+
+type slot struct {
+	// seq is the claim index the slot is free for, or that index + 1 once
+	// its message is published
+	seq  atomic.Uint64
+	data []byte
+	// done is acknowledged once the message is written, nil if its
+	// writer does not wait
+	done chan error
+	_    [cacheLine - 40]byte
+}
+
+type stripe struct {
+	n atomic.Uint64
+	_ [cacheLine - 8]byte
+}
+
+// readyNow is returned by wait when there are messages already
+var readyNow = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// newQueue generate the queue holding at least size messages, and at least
+// two so that a published slot is never taken for a free one
+func newQueue(size int) *queue {
+	n := 2
+	for n < size {
+		n <<= 1
+	}
+	q := &queue{
+		slots:   make([]slot, n),
+		mask:    uint64(n - 1),
+		readyCh: make(chan struct{}, 1),
+		spaceCh: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	for i := range q.slots {
+		q.slots[i].seq.Store(uint64(i))
+	}
+	q.space = sync.NewCond(&q.lock)
+	return q
+}
+
+// push enqueues the message with its acknowledgement channel, waiting for
+// room if the queue is full. It returns false if the queue is closed
+func (q *queue) push(b []byte, done chan error) bool {
+	if q.closed.Load() {
+		return false
+	}
+	i := q.tail.Add(1) - 1
+	s := &q.slots[i&q.mask]
+	if s.seq.Load() != i && !q.waitFree(s, i) {
+		return false
+	}
+	q.publish(s, i, b, done)
+	return true
+}
+
+// tryPush enqueues the message only if there is room for it and the queue
+// is not closed, a slot is claimed once it is free so that the producer
+// never waits on it
+func (q *queue) tryPush(b []byte, done chan error) bool {
+	if q.closed.Load() {
+		return false
+	}
+	for {
+		i := q.tail.Load()
+		s := &q.slots[i&q.mask]
+		if s.seq.Load() != i {
+			return false
+		}
+		if q.tail.CompareAndSwap(i, i+1) {
+			q.publish(s, i, b, done)
+			return true
+		}
+	}
+}
+
+// pushContext enqueues the message like push, it gives up with the error
+// of ctx if ctx is done while the queue is full, and with ErrClosed once
+// the queue is closed
+func (q *queue) pushContext(ctx context.Context, b []byte, done chan error) error {
+	for {
+		if q.closed.Load() {
+			return ErrClosed
+		}
+		if q.tryPush(b, done) {
+			return nil
+		}
+		if err := q.waitSpace(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// publish stores the message in the slot claimed with index i and wakes
+// the consumer
+func (q *queue) publish(s *slot, i uint64, b []byte, done chan error) {
+	s.data, s.done = b, done
+	s.seq.Store(i + 1)
+	q.bytes[i%byteStripes].n.Add(uint64(len(b)))
+
+	if q.sleeping.Load() && q.sleeping.CompareAndSwap(true, false) {
+		select {
+		case q.readyCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// waitFree waits until the consumer frees the slot for claim index i, it
+// returns false if the queue is closed first
+func (q *queue) waitFree(s *slot, i uint64) bool {
+	// the consumer is usually a batch away
+	for range 64 {
+		runtime.Gosched()
+		if s.seq.Load() == i {
+			return true
+		}
+	}
+
+	q.waiters.Add(1)
+	defer q.waiters.Add(-1)
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for s.seq.Load() != i {
+		if q.closed.Load() {
+			return false
+		}
+		q.space.Wait()
+	}
+	return true
+}
+
+// waitSpace waits until the consumer takes a message off the full queue
+func (q *queue) waitSpace(ctx context.Context) error {
+	q.waiters.Add(1)
+	defer q.waiters.Add(-1)
+	q.lock.Lock()
+	space := q.spaceCh
+	q.lock.Unlock()
+
+	// the consumer may have freed the slot before it saw the waiter
+	i := q.tail.Load()
+	if q.slots[i&q.mask].seq.Load() == i {
+		return nil
+	}
+	select {
+	case <-space:
+		return nil
+	case <-q.done:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// close wakes the waiting producers, the messages pushed afterwards are
+// refused
+func (q *queue) close() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.closed.Load() {
+		return
+	}
+	q.closed.Store(true)
+	q.space.Broadcast()
+	close(q.done)
+}
+
+// drain passes the published messages and their acknowledgement channels
+// to fn in order, at most one queue length of them so that the caller gets
+// to handle its other events. It returns the number of messages
+func (q *queue) drain(fn func([]byte, chan error)) int {
+	h := q.head.Load()
+	n := 0
+	for ; n < len(q.slots); n++ {
+		s := &q.slots[h&q.mask]
+		if s.seq.Load() != h+1 {
+			break
+		}
+		data, done := s.data, s.done
+		s.data, s.done = nil, nil
+		s.seq.Store(h + uint64(len(q.slots)))
+		h++
+		q.head.Store(h)
+		if q.waiters.Load() > 0 {
+			q.lock.Lock()
+			q.space.Broadcast()
+			close(q.spaceCh)
+			q.spaceCh = make(chan struct{})
+			q.lock.Unlock()
+		}
+		fn(data, done)
+	}
+	return n
+}
+
+// wait returns the channel the consumer waits on for new messages, it is
+// ready at once if messages were published meanwhile
+func (q *queue) wait() <-chan struct{} {
+	q.sleeping.Store(true)
+	h := q.head.Load()
+	if q.slots[h&q.mask].seq.Load() == h+1 {
+		q.sleeping.Store(false)
+		return readyNow
+	}
+	return q.readyCh
+}
+
+// len returns the number of claimed messages not yet taken by the consumer
+func (q *queue) len() int {
+	h := q.head.Load()
+	return int(q.tail.Load() - h)
+}
+
+// cap returns the number of messages the queue holds
+func (q *queue) cap() int {
+	return len(q.slots)
+}
+
+// pushed returns the number of messages and bytes enqueued so far
+func (q *queue) pushed() (records, bytes uint64) {
+	for i := range q.bytes {
+		bytes += q.bytes[i].n.Load()
+	}
+	return q.tail.Load(), bytes
+}
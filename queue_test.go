@@ -0,0 +1,109 @@
+package rollingwriter
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueue(t *testing.T) {
+	q := newQueue(100)
+	assert.Equal(t, 128, q.cap())
+
+	done := make(chan error, 1)
+	q.push([]byte("a"), nil)
+	q.push([]byte("bc"), done)
+	assert.Equal(t, 2, q.len())
+	records, bytes := q.pushed()
+	assert.Equal(t, uint64(2), records)
+	assert.Equal(t, uint64(3), bytes)
+
+	var got []string
+	var acks []chan error
+	assert.Equal(t, 2, q.drain(func(b []byte, done chan error) {
+		got = append(got, string(b))
+		acks = append(acks, done)
+	}))
+	assert.Equal(t, []string{"a", "bc"}, got)
+	assert.Equal(t, []chan error{nil, done}, acks)
+	assert.Equal(t, 0, q.len())
+
+	// the consumer is woken by the next message
+	ready := q.wait()
+	q.push([]byte("d"), nil)
+	<-ready
+	assert.Equal(t, 1, q.drain(func([]byte, chan error) {}))
+}
+
+func TestQueueProducers(t *testing.T) {
+	const producers = 8
+	const messages = 10000
+	// a small queue keeps the producers waiting for room
+	q := newQueue(16)
+
+	var wg sync.WaitGroup
+	for p := range producers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range messages {
+				b := make([]byte, 8)
+				binary.BigEndian.PutUint32(b, uint32(p))
+				binary.BigEndian.PutUint32(b[4:], uint32(i))
+				q.push(b, nil)
+			}
+		}()
+	}
+
+	// every producer's messages come out in order
+	next := make([]uint32, producers)
+	for n := 0; ; {
+		n += q.drain(func(b []byte, _ chan error) {
+			p, i := binary.BigEndian.Uint32(b), binary.BigEndian.Uint32(b[4:])
+			assert.Equal(t, next[p], i)
+			next[p]++
+		})
+		if n == producers*messages {
+			break
+		}
+		<-q.wait()
+	}
+	wg.Wait()
+	assert.Equal(t, 0, q.len())
+}
+
+func TestQueuePushContext(t *testing.T) {
+	q := newQueue(1)
+	assert.Equal(t, 2, q.cap())
+	assert.True(t, q.tryPush([]byte("a"), nil))
+	assert.True(t, q.tryPush([]byte("b"), nil))
+	assert.False(t, q.tryPush([]byte("c"), nil))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, q.pushContext(ctx, []byte("c"), nil))
+
+	// the waiting producer gets the slot taken off by the consumer
+	done := make(chan error, 1)
+	go func() { done <- q.pushContext(context.Background(), []byte("c"), nil) }()
+	assert.Eventually(t, func() bool { return q.waiters.Load() == 1 }, time.Second, time.Millisecond)
+	var got []string
+	q.drain(func(b []byte, _ chan error) { got = append(got, string(b)) })
+	assert.Nil(t, <-done)
+	assert.True(t, q.tryPush([]byte("d"), nil))
+
+	// the waiting producers give up once the queue is closed
+	go func() { done <- q.pushContext(context.Background(), []byte("e"), nil) }()
+	pushed := make(chan bool, 1)
+	go func() { pushed <- q.push([]byte("f"), nil) }()
+	assert.Eventually(t, func() bool { return q.waiters.Load() == 2 }, time.Second, time.Millisecond)
+	q.close()
+	assert.Equal(t, ErrClosed, <-done)
+	assert.False(t, <-pushed)
+	assert.False(t, q.push([]byte("g"), nil))
+	q.drain(func(b []byte, _ chan error) { got = append(got, string(b)) })
+	assert.Equal(t, []string{"a", "b", "c", "d"}, got)
+}
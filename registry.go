@@ -0,0 +1,179 @@
+package rollingwriter
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// DefaultCompressWorkers is the default number of compression go routines
+// shared by the writers of a Registry
+const DefaultCompressWorkers = 2
+
+// ErrWriterExists defined adding a writer with a name already in use
+var ErrWriterExists = errors.New("writer already exists")
+
+// Registry owns many named rolling writers. All the writers share a single
+// rotation scheduler and a single pool of compression go routines instead
+// of starting their own
+type Registry struct {
+	writers    map[string]*Writer
+	sched      *scheduler
+	compressor *compressPool
+	closed     bool
+	lock       sync.Mutex
+}
+
+// RegistryStats give out the stats of every writer in a registry and
+// their sum
+type RegistryStats struct {
+	Total   Stats            `json:"total"`
+	Writers map[string]Stats `json:"writers"`
+}
+
+// NewRegistry generate an empty Registry, compressWorkers is the number of
+// go routines compressing backups. DefaultCompressWorkers is used if it
+// is less than 1
+func NewRegistry(compressWorkers int) *Registry {
+	if compressWorkers < 1 {
+		compressWorkers = DefaultCompressWorkers
+	}
+	return &Registry{
+		writers:    make(map[string]*Writer),
+		sched:      newScheduler(systemClock{}),
+		compressor: newCompressPool(compressWorkers),
+	}
+}
+
+// Add generate a rolling writer with the given config and register it
+// under name
+func (r *Registry) Add(name string, c *Config) (RollingWriter, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.closed {
+		return nil, ErrClosed
+	}
+	if _, ok := r.writers[name]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrWriterExists, name)
+	}
+
+	writer, err := createWriter(c, r.sched, r.compressor)
+	if err != nil {
+		return nil, err
+	}
+	if err = writer.startFileWriterLoop(); err != nil {
+		writer.monitor.Close()
+		return nil, err
+	}
+	r.writers[name] = writer
+	return writer, nil
+}
+
+// Get returns the writer registered under name
+func (r *Registry) Get(name string) (RollingWriter, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	writer, ok := r.writers[name]
+	if !ok {
+		return nil, false
+	}
+	return writer, true
+}
+
+// Names returns the names of all the registered writers
+func (r *Registry) Names() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	names := make([]string, 0, len(r.writers))
+	for name := range r.writers {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Close closes the writer registered under name and removes it
+func (r *Registry) Close(name string) error {
+	r.lock.Lock()
+	writer, ok := r.writers[name]
+	delete(r.writers, name)
+	r.lock.Unlock()
+
+	if !ok {
+		return ErrInvalidArgument
+	}
+	return writer.Close()
+}
+
+// CloseAll closes every writer, waits for the pending compressions and
+// stops the shared go routines. The registry can not be used afterwards
+func (r *Registry) CloseAll() error {
+	r.lock.Lock()
+	if r.closed {
+		r.lock.Unlock()
+		return nil
+	}
+	r.closed = true
+	writers := r.writers
+	r.writers = make(map[string]*Writer)
+	r.lock.Unlock()
+
+	var errs []error
+	for _, writer := range writers {
+		if err := writer.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	r.sched.stop()
+	r.compressor.close()
+	return errors.Join(errs...)
+}
+
+// Stats returns the stats of all the registered writers
+func (r *Registry) Stats() RegistryStats {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	stats := RegistryStats{Writers: make(map[string]Stats, len(r.writers))}
+	for name, writer := range r.writers {
+		s := writer.Stats()
+		stats.Writers[name] = s
+		stats.Total.Add(s)
+	}
+	return stats
+}
+
+// compressPool compresses and prunes backups files on a fixed number of
+// go routines
+type compressPool struct {
+	jobs chan func()
+	wg   sync.WaitGroup
+}
+
+func newCompressPool(workers int) *compressPool {
+	p := &compressPool{jobs: make(chan func(), 64)}
+	p.wg.Add(workers)
+	for range workers {
+		go func() {
+			defer p.wg.Done()
+			for job := range p.jobs {
+				job()
+			}
+		}()
+	}
+	return p
+}
+
+// submit queues the backup job, it blocks the writer only when all the
+// workers are busy and the queue is full
+func (p *compressPool) submit(job func()) {
+	p.jobs <- job
+}
+
+// close waits for the queued compressions to finish
+func (p *compressPool) close() {
+	close(p.jobs)
+	p.wg.Wait()
+}
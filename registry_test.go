@@ -0,0 +1,50 @@
+package rollingwriter
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry(1)
+
+	access := NewDefaultConfig()
+	access.FilePath = "./test/registry/access.log"
+	audit := NewDefaultConfig()
+	audit.FilePath = "./test/registry/audit.log"
+	audit.RollingPolicy = VolumeRolling
+
+	_, err := r.Add("access", &access)
+	assert.Nil(t, err)
+	_, err = r.Add("audit", &audit)
+	assert.Nil(t, err)
+	_, err = r.Add("audit", &audit)
+	assert.True(t, errors.Is(err, ErrWriterExists))
+	assert.ElementsMatch(t, []string{"access", "audit"}, r.Names())
+
+	w, ok := r.Get("access")
+	assert.True(t, ok)
+	w.Write([]byte("hello\n"))
+	w.Write([]byte("world\n"))
+	_, ok = r.Get("none")
+	assert.False(t, ok)
+
+	stats := r.Stats()
+	assert.Equal(t, uint64(2), stats.Writers["access"].Records)
+	assert.Equal(t, uint64(12), stats.Total.Bytes)
+
+	assert.Nil(t, r.Close("access"))
+	assert.Equal(t, ErrInvalidArgument, r.Close("access"))
+	b, _ := os.ReadFile(access.FilePath)
+	assert.Equal(t, "hello\nworld\n", string(b))
+
+	assert.Nil(t, r.CloseAll())
+	assert.Nil(t, r.CloseAll())
+	_, err = r.Add("access", &access)
+	assert.Equal(t, ErrClosed, err)
+	os.RemoveAll("./test/registry")
+	clean()
+}
@@ -0,0 +1,119 @@
+package rollingwriter
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// location returns the location of the time tags, the local time if none
+// is configured
+func (c *Config) location() *time.Location {
+	if c.Location != nil {
+		return c.Location
+	}
+	return time.Local
+}
+
+// backup is a rotated file found by the retention
+type backup struct {
+	path string
+	at   time.Time
+	seq  int
+}
+
+// listBackups returns the backups of the log file, oldest first
+func listBackups(c *Config) ([]backup, error) {
+	dir, base := filepath.Split(c.FilePath)
+	entries, err := c.fs().ReadDir(filepath.Clean(dir + "."))
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []backup
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), base+".") {
+			continue
+		}
+		if b, ok := parseBackupName(c, entry.Name()[len(base)+1:]); ok {
+			b.path = filepath.Join(dir, entry.Name())
+			backups = append(backups, b)
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		if backups[i].at.Equal(backups[j].at) {
+			return backups[i].seq < backups[j].seq
+		}
+		return backups[i].at.Before(backups[j].at)
+	})
+	return backups, nil
+}
+
+// parseBackupName parses the part of a backup file name after the log file
+// name: [gz.]timetag[-timetag][.seq]
+func parseBackupName(c *Config, suffix string) (backup, bool) {
+	suffix = strings.TrimPrefix(suffix, "gz.")
+	if at, ok := parseTimeTag(c, suffix); ok {
+		return backup{at: at}, true
+	}
+
+	i := strings.LastIndexByte(suffix, '.')
+	if i < 0 {
+		return backup{}, false
+	}
+	seq, err := strconv.Atoi(suffix[i+1:])
+	if err != nil {
+		return backup{}, false
+	}
+	at, ok := parseTimeTag(c, suffix[:i])
+	if !ok {
+		return backup{}, false
+	}
+	return backup{at: at, seq: seq}, true
+}
+
+// parseTimeTag parses a time tag or a range of time tags, returning the
+// start of the range
+func parseTimeTag(c *Config, tag string) (time.Time, bool) {
+	if at, err := time.ParseInLocation(c.TimeTagFormat, tag, c.location()); err == nil {
+		return at, true
+	}
+
+	// the time tag format may contain '-' too
+	for i := strings.IndexByte(tag, '-'); i >= 0; {
+		at, err := time.ParseInLocation(c.TimeTagFormat, tag[:i], c.location())
+		if err == nil {
+			if _, err = time.ParseInLocation(c.TimeTagFormat, tag[i+1:], c.location()); err == nil {
+				return at, true
+			}
+		}
+		next := strings.IndexByte(tag[i+1:], '-')
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return time.Time{}, false
+}
+
+// pruneBackups removes the oldest backups in excess of MaxBackups, it
+// returns the last error
+func pruneBackups(c *Config) (err error) {
+	backups, err := listBackups(c)
+	if err != nil {
+		log.Println("error in list backups", err)
+		return err
+	}
+	for len(backups) > c.MaxBackups {
+		if errR := c.fs().Remove(backups[0].path); errR != nil && !os.IsNotExist(errR) {
+			log.Println("error in remove backup", errR)
+			err = errR
+		}
+		backups = backups[1:]
+	}
+	return err
+}
@@ -0,0 +1,83 @@
+package rollingwriter
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPruneBackups(t *testing.T) {
+	c := &Config{
+		FilePath:      "./test/retention/app.log",
+		TimeTagFormat: "2006010215",
+		TimeZone:      "Asia/Kolkata",
+		MaxBackups:    2,
+	}
+	c.Location, _ = time.LoadLocation(c.TimeZone)
+	os.MkdirAll("./test/retention", 0700)
+	for _, name := range []string{
+		"app.log", "app.log.2024010100", "app.log.gz.2024010101", "app.log.2024010102",
+		"app.log.2024010102.1", "app.log.2024010103.tmp", "app.log.notatag", "other.log.2024010100",
+	} {
+		os.WriteFile(filepath.Join("./test/retention", name), nil, 0644)
+	}
+
+	backups, err := listBackups(c)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(backups))
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, c.Location), backups[0].at)
+	assert.Equal(t, "test/retention/app.log.2024010102.1", backups[3].path)
+
+	pruneBackups(c)
+	entries, _ := os.ReadDir("./test/retention")
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{
+		"app.log", "app.log.2024010102", "app.log.2024010102.1", "app.log.2024010103.tmp",
+		"app.log.notatag", "other.log.2024010100",
+	}, names)
+
+	// the time tags are rendered in the location
+	start := time.Date(2024, 1, 1, 20, 0, 0, 0, time.UTC)
+	assert.Equal(t, "test/retention/app.log.2024010201", backupFileName(c, start))
+	os.RemoveAll("./test/retention")
+	clean()
+}
+
+func TestPruneFaults(t *testing.T) {
+	mem := NewMemFS()
+	faults := NewFaultFS(mem)
+	c := &Config{
+		FilePath:      "/logs/app.log",
+		TimeTagFormat: "2006010215",
+		MaxBackups:    1,
+		FileSystem:    faults,
+	}
+	mem.MkdirAll("/logs", 0700)
+	for _, name := range []string{"app.log.2024010100", "app.log.2024010101", "app.log.2024010102"} {
+		file, _ := mem.OpenFile(filepath.Join("/logs", name), DefaultFileFlag, 0644)
+		file.Close()
+	}
+
+	// nothing is removed if the backups can not be listed
+	faults.Inject(Fault{Op: OpReadDir, Err: syscall.EIO, Times: 1})
+	pruneBackups(c)
+	entries, _ := mem.ReadDir("/logs")
+	assert.Equal(t, 3, len(entries))
+
+	// a backup which can not be removed does not keep the others
+	faults.Inject(Fault{Op: OpRemove, Path: "app.log.2024010100", Err: syscall.EACCES})
+	pruneBackups(c)
+	entries, _ = mem.ReadDir("/logs")
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"app.log.2024010100", "app.log.2024010102"}, names)
+}
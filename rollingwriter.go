@@ -1,17 +1,19 @@
 package rollingwriter
 
 import (
+	"context"
 	"errors"
 	"io"
 	"os"
 	"time"
 )
 
-// RollingPolicies giveout 3 policy for rolling.
+// RollingPolicies giveout 4 policy for rolling.
 const (
 	WithoutRolling = iota
 	TimeRolling
 	VolumeRolling
+	RecordRolling
 
 	// DefaultFileMode set the default open mode rw-r--r-- by default
 	DefaultFileMode = os.FileMode(0644)
@@ -23,6 +25,12 @@ const (
 	// MinBufferSize define the minimum buffer size for log messages, 1 MB
 	DefaultBufferSize = 1024 * 1024
 
+	// TagFirstWrite tags the backups with the time of their first record
+	TagFirstWrite = "first_write"
+	// TagWriteRange tags the backups with the time of their first and last
+	// records: [fileName].[fileExt].[FirstTag]-[LastTag]
+	TagWriteRange = "write_range"
+
 	// MinQueueSize define the minimum queue size for asynchronize write
 	MinQueueSize = 64
 	// MinBufferSize define the minimum buffer size for log messages
@@ -47,23 +55,122 @@ var (
 	ErrInvalidArgument = errors.New("error argument invalid")
 	// ErrQueueFull defined the queue full
 	ErrQueueFull = errors.New("async log queue full")
+	// ErrSinkStalled defined the sink of a TeeWriter which stopped taking
+	// messages
+	ErrSinkStalled = errors.New("log sink stalled")
+)
+
+// RotationReason give out why a file was rotated
+type RotationReason int
+
+// Rotation reasons
+const (
+	// RotationTime is a rotation by the TimeRolling schedule
+	RotationTime RotationReason = iota
+	// RotationSize is a rotation by the VolumeRolling threshold
+	RotationSize
+	// RotationManual is a rotation requested by the application
+	RotationManual
+	// RotationSignal is a rotation requested with an os signal
+	RotationSignal
+	// RotationCustom is a rotation requested by a RotationPolicy
+	RotationCustom
+	// RotationRecords is a rotation by the RecordRolling count
+	RotationRecords
+	// RotationAge is a rotation of a file open for longer than MaxAge
+	RotationAge
+	// RotationIdle is a rotation of a file not written for IdleTimeout
+	RotationIdle
 )
 
-// FileMonitor writes new backup file event.
+func (r RotationReason) String() string {
+	switch r {
+	case RotationTime:
+		return "time"
+	case RotationSize:
+		return "size"
+	case RotationManual:
+		return "manual"
+	case RotationSignal:
+		return "signal"
+	case RotationCustom:
+		return "custom"
+	case RotationRecords:
+		return "records"
+	case RotationAge:
+		return "age"
+	case RotationIdle:
+		return "idle"
+	}
+	return "unknown"
+}
+
+// RotationTrigger is a rotation request of a FileMonitor
+type RotationTrigger struct {
+	Reason RotationReason
+	// At is the time the rotation was requested
+	At time.Time
+}
+
+// RotationEvent describes a completed rotation
+type RotationEvent struct {
+	Reason RotationReason `json:"reason"`
+	// BackupPath is the file the rotated log was renamed to, it is
+	// compressed afterwards if Compress is set
+	BackupPath string `json:"backup_path"`
+	// StartTime and EndTime are the time the rotated file was opened and
+	// the time it was rotated
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	// Bytes is the size of the rotated file
+	Bytes int64 `json:"bytes"`
+	// TriggeredAt is the time the rotation was requested
+	TriggeredAt time.Time `json:"triggered_at"`
+}
+
+// FileMonitor decides when the file is rotated
 type FileMonitor interface {
-	// RotationEvents returns a string channel
-	// when rotation events occur, new backup filenames will be sent on this channel
-	RotationEvents() chan string
+	// Triggers returns the channel on which rotations are requested, the
+	// monitor never blocks on it, a request is dropped while the previous
+	// one is still pending
+	Triggers() <-chan RotationTrigger
 	// Close the Manager
 	Close()
 }
 
+// RotationPolicy is a user defined rotation trigger, it runs along with the
+// RollingPolicy of the config. A policy instance serves a single writer
+type RotationPolicy interface {
+	// Start is called once when the writer is started. trigger requests a
+	// rotation, it never blocks and can be called from any go routine
+	Start(clock Clock, trigger func(RotationReason))
+	// Written is called by the writer go routine for every message
+	// written to the file, n is the message size
+	Written(n int)
+	// Rotated is called by the writer go routine after every rotation
+	Rotated(event RotationEvent)
+	// Stop is called when the writer is closed
+	Stop()
+}
+
 // RollingWriter implement the io writer
 type RollingWriter interface {
 	io.Writer
 	Close() error
 }
 
+// Syncer is implemented by the writers which can commit the written
+// messages to stable storage
+type Syncer interface {
+	Sync() error
+}
+
+// ContextWriter is implemented by the writers whose writes give up when
+// the context is done
+type ContextWriter interface {
+	WriteContext(ctx context.Context, b []byte) (int, error)
+}
+
 // LogFileFormatter log file format function
 type LogFileFormatter func(time.Time) string
 
@@ -93,20 +200,31 @@ type Config struct {
 	// Directory mode, mode of directory created
 	DirMode os.FileMode `json:"dir_mode,omitempty"`
 
-	// MaxBackups is the maximum number of old files to retain, if set 0 will
+	// MaxBackups is the maximum number of old files to retain, the oldest
+	// backups, compressed or not, are deleted after every rotation. If set 0
 	// all old files will be retained.
 	MaxBackups int `json:"max_remain,omitempty"`
 
 	// RollingPolicy give out the rolling policy
-	// We got 3 policies(actually, 2):
+	// We got 4 policies(actually, 3):
 	//
 	//	1. WithoutRolling: no rolling will happen
 	//	2. TimeRolling: rolling by time
 	//	3. VolumeRolling: rolling by file size
+	//	4. RecordRolling: rolling by number of records
 	RollingPolicy      int    `json:"rolling_ploicy,omitempty"`
 	RollingTimePattern string `json:"rolling_time_pattern,omitempty"`
 	RollingVolumeSize  string `json:"rolling_volume_size,omitempty"`
 
+	// RollingInterval replaces RollingTimePattern with a period aligned to
+	// the wall clock, e.g. "15m", "1h", "hourly" or "daily". The backups
+	// are tagged with the start of the period they cover
+	RollingInterval string `json:"rolling_interval,omitempty"`
+
+	// RollingRecords is the number of newline terminated records of each
+	// file under RecordRolling
+	RollingRecords int `json:"rolling_records,omitempty"`
+
 	// Compress will compress log file with gzip
 	Compress bool `json:"compress,omitempty"`
 
@@ -118,6 +236,57 @@ type Config struct {
 
 	// Max queue size for log messages
 	QueueSize int `json:"max_queue_size,omitempty"`
+
+	// Synchronous makes Write return only once the message is written to
+	// the file, the messages are still written and rotated by the writer go
+	// routines. Write returns the error of the file write
+	Synchronous bool `json:"synchronous,omitempty"`
+
+	// Fsync commits every synchronous write to stable storage before Write
+	// returns, and the file before it is rotated
+	Fsync bool `json:"fsync,omitempty"`
+
+	// GroupCommit makes Write wait for the next fsync like Synchronous and
+	// Fsync, but the records which arrived during an fsync are written and
+	// synced together by the next one
+	GroupCommit bool `json:"group_commit,omitempty"`
+
+	// BackupTimeTag selects the time in the backup file names, by default it
+	// is the time the file was opened, or the start of its period under
+	// RollingInterval. TagFirstWrite and TagWriteRange use the time of the
+	// records written to the file instead
+	BackupTimeTag string `json:"backup_time_tag,omitempty"`
+
+	// TimeZone is the IANA name of the location, e.g. "UTC" or "Asia/Kolkata",
+	// of the rolling time pattern, the time tags of the backups and their
+	// parsing by the retention. The local time is used by default
+	TimeZone string `json:"time_zone,omitempty"`
+
+	// Location overrides TimeZone
+	Location *time.Location `json:"-"`
+
+	// MaxAge rotates the file once it has been open this long, whatever
+	// the rolling policy is. It is a time.ParseDuration string like "24h"
+	MaxAge string `json:"max_age,omitempty"`
+
+	// IdleTimeout rotates the file when nothing has been written to it for
+	// this long, e.g. "30m". Empty files are never rotated by MaxAge and
+	// IdleTimeout, as if FilterEmptyBackup was set
+	IdleTimeout string `json:"idle_timeout,omitempty"`
+
+	// RotateSignals rotate the file when one of the signals is received,
+	// e.g. syscall.SIGHUP for logrotate style scripts
+	RotateSignals []os.Signal `json:"-"`
+
+	// RotationPolicy is a user defined rotation trigger
+	RotationPolicy RotationPolicy `json:"-"`
+
+	// Clock is the time source of the writer, the system clock by default
+	Clock Clock `json:"-"`
+
+	// FileSystem is where the log and backup files live, the os file system
+	// by default
+	FileSystem FileSystem `json:"-"`
 }
 
 // NewDefaultConfig return the default config
@@ -162,8 +331,9 @@ func WithCompress() Option {
 	}
 }
 
-// WithMaxBackups sets the maximum number of backup files to retain
-// 0 will disable pruning backups files, this is the default behaviour
+// WithMaxBackups sets the maximum number of backup files to retain, the
+// oldest ones are deleted. 0 will disable pruning backups files, this is the
+// default behaviour
 func WithMaxBackups(max int) Option {
 	return func(p *Config) {
 		p.MaxBackups = max
@@ -186,6 +356,103 @@ func WithRollingTimePattern(pattern string) Option {
 	}
 }
 
+// WithRollingRecords set the number of newline terminated records after
+// which the file is rotated
+func WithRollingRecords(records int) Option {
+	return func(p *Config) {
+		p.RollingPolicy = RecordRolling
+		p.RollingRecords = records
+	}
+}
+
+// WithBackupTimeTag set the time in the backup file names, TagFirstWrite or
+// TagWriteRange
+func WithBackupTimeTag(tag string) Option {
+	return func(p *Config) {
+		p.BackupTimeTag = tag
+	}
+}
+
+// WithSynchronous make Write return once the message is written to the
+// file, and synced to stable storage too if fsync is set
+func WithSynchronous(fsync bool) Option {
+	return func(p *Config) {
+		p.Synchronous = true
+		p.Fsync = fsync
+	}
+}
+
+// WithGroupCommit make Write return once the message is synced to stable
+// storage along with the other messages written meanwhile
+func WithGroupCommit() Option {
+	return func(p *Config) {
+		p.GroupCommit = true
+	}
+}
+
+// WithClock set the time source of the writer, mostly for tests with a
+// FakeClock
+func WithClock(clock Clock) Option {
+	return func(p *Config) {
+		p.Clock = clock
+	}
+}
+
+// WithFileSystem set the file system of the log and backup files, e.g. a
+// MemFS in tests
+func WithFileSystem(fs FileSystem) Option {
+	return func(p *Config) {
+		p.FileSystem = fs
+	}
+}
+
+// WithLocation set the location of the rolling time pattern and the time
+// tags
+func WithLocation(loc *time.Location) Option {
+	return func(p *Config) {
+		p.Location = loc
+	}
+}
+
+// WithMaxAge rotate the file once it has been open for the duration
+func WithMaxAge(age time.Duration) Option {
+	return func(p *Config) {
+		p.MaxAge = age.String()
+	}
+}
+
+// WithIdleTimeout rotate the file when nothing has been written to it for
+// the duration
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(p *Config) {
+		p.IdleTimeout = timeout.String()
+	}
+}
+
+// WithRotateOnSignal rotate the file when one of the signals is received
+func WithRotateOnSignal(sigs ...os.Signal) Option {
+	return func(p *Config) {
+		p.RotateSignals = sigs
+	}
+}
+
+// WithRotationPolicy set a user defined rotation trigger, running along
+// with the rolling policy
+func WithRotationPolicy(policy RotationPolicy) Option {
+	return func(p *Config) {
+		p.RotationPolicy = policy
+	}
+}
+
+// WithRollingInterval set the time rolling policy with a period aligned to
+// the wall clock like "15m", "hourly" or "daily"
+func WithRollingInterval(interval string) Option {
+	return func(p *Config) {
+		p.RollingPolicy = TimeRolling
+		p.RollingInterval = interval
+	}
+}
+
 // WithRollingVolumeSize set the rolling file truncation threshold size
 func WithRollingVolumeSize(size string) Option {
 	return func(p *Config) {
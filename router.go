@@ -0,0 +1,303 @@
+package rollingwriter
+
+import (
+	"container/list"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron"
+)
+
+// RouteKeyPlaceholder is replaced by the routing key in the FilePath of the
+// RouterConfig template, e.g. "logs/{key}/app.log"
+const RouteKeyPlaceholder = "{key}"
+
+// DefaultRouteKey is used for records without a routing key
+const DefaultRouteKey = "default"
+
+// KeyFunc extracts the routing key from a log record
+type KeyFunc func([]byte) string
+
+// RouterConfig give out the config for a RoutingWriter
+type RouterConfig struct {
+	// Template is the config of every routed file, its FilePath must
+	// contain RouteKeyPlaceholder. It can not have a RotationPolicy, which
+	// serves a single writer, use NewRotationPolicy instead
+	Template Config
+
+	// NewRotationPolicy returns the rotation policy of the file of the key,
+	// if not nil
+	NewRotationPolicy func(key string) RotationPolicy
+
+	// KeyFunc extracts the key of records written with Write, if nil
+	// they are all routed to DefaultRouteKey
+	KeyFunc KeyFunc
+
+	// IdleTimeout closes the files with no writes for this long, 0 keeps
+	// the files open until they are evicted by MaxOpenFiles
+	IdleTimeout time.Duration
+
+	// MaxOpenFiles caps the number of open files, the least recently used
+	// file is closed to open a new one. 0 means no limit
+	MaxOpenFiles int
+}
+
+// RoutingWriter routes each record to a rolling file chosen by its key.
+// The files are created lazily from the template config and share one
+// scheduler and compression pool
+type RoutingWriter struct {
+	conf       RouterConfig
+	routes     map[string]*route
+	lru        *list.List
+	sched      *scheduler
+	compressor *compressPool
+	closed     bool
+	lock       sync.Mutex
+}
+
+type route struct {
+	key      string
+	writer   *Writer
+	elem     *list.Element
+	lastUse  time.Time
+	refs     int
+	detached bool
+	// opened is closed once the file is opened, or failed to open with err
+	opened chan struct{}
+	err    error
+}
+
+// NewRoutingWriter generate the RoutingWriter with given config
+func NewRoutingWriter(c RouterConfig) (*RoutingWriter, error) {
+	if !strings.Contains(c.Template.FilePath, RouteKeyPlaceholder) || c.Template.RotationPolicy != nil {
+		return nil, ErrInvalidArgument
+	}
+
+	r := &RoutingWriter{
+		conf:       c,
+		routes:     make(map[string]*route),
+		lru:        list.New(),
+		sched:      newScheduler(c.Template.clock()),
+		compressor: newCompressPool(DefaultCompressWorkers),
+	}
+
+	if c.IdleTimeout > 0 {
+		r.sched.schedule(cron.Every(c.IdleTimeout/2), r.evictIdle)
+	}
+	return r, nil
+}
+
+// Write routes the record by the key given by the KeyFunc
+func (r *RoutingWriter) Write(b []byte) (int, error) {
+	key := DefaultRouteKey
+	if r.conf.KeyFunc != nil {
+		key = r.conf.KeyFunc(b)
+	}
+	return r.WriteKey(key, b)
+}
+
+// WriteKey writes the record to the file of the given key
+func (r *RoutingWriter) WriteKey(key string, b []byte) (int, error) {
+	rt, err := r.acquire(sanitizeRouteKey(key))
+	if err != nil {
+		return 0, err
+	}
+	defer r.release(rt)
+	return rt.writer.Write(b)
+}
+
+// Sync commits the records written so far to the open files, the files
+// closed meanwhile were flushed by their Close
+func (r *RoutingWriter) Sync() error {
+	r.lock.Lock()
+	if r.closed {
+		r.lock.Unlock()
+		return ErrClosed
+	}
+	routes := make([]*route, 0, len(r.routes))
+	for _, rt := range r.routes {
+		rt.refs++
+		routes = append(routes, rt)
+	}
+	r.lock.Unlock()
+
+	var errs []error
+	for _, rt := range routes {
+		<-rt.opened
+		if rt.err == nil {
+			if err := rt.writer.Sync(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		r.release(rt)
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes all the routed files
+func (r *RoutingWriter) Close() error {
+	r.lock.Lock()
+	if r.closed {
+		r.lock.Unlock()
+		return nil
+	}
+	r.closed = true
+	var toClose []*Writer
+	for _, rt := range r.routes {
+		if w := r.detach(rt); w != nil {
+			toClose = append(toClose, w)
+		}
+	}
+	r.lock.Unlock()
+
+	var errs []error
+	for _, w := range toClose {
+		if err := w.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	r.sched.stop()
+	r.compressor.close()
+	return errors.Join(errs...)
+}
+
+// OpenFiles returns the number of routed files currently open
+func (r *RoutingWriter) OpenFiles() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return len(r.routes)
+}
+
+// acquire returns the route of key, opening its file if necessary. The
+// file is opened without the lock held, the other writers of the key wait
+// for it. The route can not be closed until it is released
+func (r *RoutingWriter) acquire(key string) (*route, error) {
+	r.lock.Lock()
+	if r.closed {
+		r.lock.Unlock()
+		return nil, ErrClosed
+	}
+
+	if rt, ok := r.routes[key]; ok {
+		rt.refs++
+		rt.lastUse = r.sched.clock.Now()
+		r.lru.MoveToFront(rt.elem)
+		r.lock.Unlock()
+
+		<-rt.opened
+		if rt.err != nil {
+			r.release(rt)
+			return nil, rt.err
+		}
+		return rt, nil
+	}
+
+	rt := &route{key: key, lastUse: r.sched.clock.Now(), refs: 1, opened: make(chan struct{})}
+	rt.elem = r.lru.PushFront(rt)
+	r.routes[key] = rt
+
+	// make room for the new file
+	var toClose []*Writer
+	for r.conf.MaxOpenFiles > 0 && len(r.routes) > r.conf.MaxOpenFiles {
+		if w := r.detach(r.lru.Back().Value.(*route)); w != nil {
+			toClose = append(toClose, w)
+		}
+	}
+	r.lock.Unlock()
+
+	for _, w := range toClose {
+		w.Close()
+	}
+
+	rt.writer, rt.err = r.open(key)
+	close(rt.opened)
+	if rt.err != nil {
+		r.lock.Lock()
+		if !rt.detached {
+			r.detach(rt)
+		}
+		r.lock.Unlock()
+		r.release(rt)
+		return nil, rt.err
+	}
+	return rt, nil
+}
+
+// open starts the writer of the key's file from the template config
+func (r *RoutingWriter) open(key string) (*Writer, error) {
+	c := r.conf.Template
+	c.FilePath = strings.ReplaceAll(c.FilePath, RouteKeyPlaceholder, key)
+	if r.conf.NewRotationPolicy != nil {
+		c.RotationPolicy = r.conf.NewRotationPolicy(key)
+	}
+	writer, err := createWriter(&c, r.sched, r.compressor)
+	if err != nil {
+		return nil, err
+	}
+	if err = writer.startFileWriterLoop(); err != nil {
+		writer.monitor.Close()
+		return nil, err
+	}
+	return writer, nil
+}
+
+// release the route, closing its file if it was evicted meanwhile
+func (r *RoutingWriter) release(rt *route) {
+	r.lock.Lock()
+	rt.refs--
+	closeWriter := rt.detached && rt.refs == 0 && rt.writer != nil
+	r.lock.Unlock()
+
+	if closeWriter {
+		rt.writer.Close()
+	}
+}
+
+// detach removes the route, it returns the writer to close if the route is
+// not in use. Must be called with the lock held
+func (r *RoutingWriter) detach(rt *route) *Writer {
+	delete(r.routes, rt.key)
+	r.lru.Remove(rt.elem)
+	rt.detached = true
+	if rt.refs == 0 && rt.writer != nil {
+		return rt.writer
+	}
+	return nil
+}
+
+// evictIdle closes the files which have not been written for IdleTimeout
+func (r *RoutingWriter) evictIdle() {
+	deadline := r.sched.clock.Now().Add(-r.conf.IdleTimeout)
+
+	r.lock.Lock()
+	var toClose []*Writer
+	for e := r.lru.Back(); e != nil; {
+		rt := e.Value.(*route)
+		if rt.lastUse.After(deadline) {
+			break
+		}
+		e = e.Prev()
+		if w := r.detach(rt); w != nil {
+			toClose = append(toClose, w)
+		}
+	}
+	r.lock.Unlock()
+
+	for _, w := range toClose {
+		w.Close()
+	}
+}
+
+// sanitizeRouteKey keeps the key from escaping the template directory, the
+// empty key is the default one and "." would name the directory itself
+func sanitizeRouteKey(key string) string {
+	switch key {
+	case "":
+		return DefaultRouteKey
+	case ".":
+		return "_"
+	}
+	return strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(key)
+}
@@ -0,0 +1,199 @@
+package rollingwriter
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoutingWriter(t *testing.T) {
+	cfg := NewDefaultConfig()
+	cfg.FilePath = "./test/router/{key}/app.log"
+	r, err := NewRoutingWriter(RouterConfig{
+		Template: cfg,
+		KeyFunc: func(b []byte) string {
+			key, _, _ := bytes.Cut(b, []byte(" "))
+			return string(key)
+		},
+		MaxOpenFiles: 2,
+	})
+	assert.Nil(t, err)
+
+	r.Write([]byte("tenant1 hello\n"))
+	r.Write([]byte("tenant2 hello\n"))
+	assert.Equal(t, 2, r.OpenFiles())
+	// tenant1 is the least recently used, it gets closed
+	r.WriteKey("../tenant3", []byte("hello\n"))
+	assert.Equal(t, 2, r.OpenFiles())
+	b, _ := os.ReadFile("./test/router/tenant1/app.log")
+	assert.Equal(t, "tenant1 hello\n", string(b))
+
+	// the open files are synced
+	assert.Nil(t, r.Sync())
+	b, _ = os.ReadFile("./test/router/tenant2/app.log")
+	assert.Equal(t, "tenant2 hello\n", string(b))
+
+	// reopened for append
+	r.Write([]byte("tenant1 again\n"))
+	assert.Nil(t, r.Close())
+	assert.Equal(t, ErrClosed, r.Sync())
+	b, _ = os.ReadFile("./test/router/tenant1/app.log")
+	assert.Equal(t, "tenant1 hello\ntenant1 again\n", string(b))
+	b, _ = os.ReadFile("./test/router/__tenant3/app.log")
+	assert.Equal(t, "hello\n", string(b))
+
+	_, err = r.Write([]byte("closed"))
+	assert.Equal(t, ErrClosed, err)
+
+	idle, err := NewRoutingWriter(RouterConfig{Template: cfg, IdleTimeout: time.Second})
+	assert.Nil(t, err)
+	idle.Close()
+	cfg.FilePath = "./test/app.log"
+	_, err = NewRoutingWriter(RouterConfig{Template: cfg})
+	assert.Equal(t, ErrInvalidArgument, err)
+	os.RemoveAll("./test/router")
+	clean()
+}
+
+func TestRoutingWriterIdle(t *testing.T) {
+	cfg := NewDefaultConfig()
+	cfg.FilePath = "./test/idle/{key}.log"
+	r, _ := NewRoutingWriter(RouterConfig{Template: cfg, IdleTimeout: time.Hour})
+
+	r.WriteKey("a", []byte("a\n"))
+	r.WriteKey("b", []byte("b\n"))
+	r.lock.Lock()
+	r.routes["a"].lastUse = time.Now().Add(-2 * time.Hour)
+	r.lock.Unlock()
+
+	r.evictIdle()
+	assert.Equal(t, 1, r.OpenFiles())
+	r.Close()
+	os.RemoveAll("./test/idle")
+	clean()
+}
+
+func TestSanitizeRouteKey(t *testing.T) {
+	for key, want := range map[string]string{
+		"tenant1":    "tenant1",
+		"":           DefaultRouteKey,
+		".":          "_",
+		"..":         "_",
+		"../etc":     "__etc",
+		"a/b":        "a_b",
+		`a\b`:        "a_b",
+		"./tenant":   "._tenant",
+		"tenant.log": "tenant.log",
+	} {
+		assert.Equal(t, want, sanitizeRouteKey(key), key)
+	}
+
+	// the keys stay in their own directory under the template directory
+	mem := NewMemFS()
+	cfg := NewDefaultConfig()
+	cfg.FilePath = "/logs/{key}/app.log"
+	cfg.FileSystem = mem
+	r, _ := NewRoutingWriter(RouterConfig{Template: cfg})
+	r.WriteKey(".", []byte("dot\n"))
+	r.WriteKey("", []byte("empty\n"))
+	r.Close()
+	_, err := mem.Stat("/logs/app.log")
+	assert.True(t, os.IsNotExist(err))
+	b, _ := mem.ReadFile("/logs/_/app.log")
+	assert.Equal(t, "dot\n", string(b))
+	b, _ = mem.ReadFile("/logs/default/app.log")
+	assert.Equal(t, "empty\n", string(b))
+}
+
+// gateFS is a FileSystem whose opens of the files named with "slow" block
+// until gate is closed
+type gateFS struct {
+	FileSystem
+	gate    chan struct{}
+	entered chan struct{}
+	opens   atomic.Int32
+}
+
+func (fs *gateFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if strings.Contains(name, "slow") {
+		if fs.opens.Add(1) == 1 {
+			close(fs.entered)
+		}
+		<-fs.gate
+	}
+	return fs.FileSystem.OpenFile(name, flag, perm)
+}
+
+func TestRoutingWriterSlowOpen(t *testing.T) {
+	mem := NewMemFS()
+	fs := &gateFS{FileSystem: mem, gate: make(chan struct{}), entered: make(chan struct{})}
+	cfg := NewDefaultConfig()
+	cfg.FilePath = "/logs/{key}.log"
+	cfg.FileSystem = fs
+	r, _ := NewRoutingWriter(RouterConfig{Template: cfg})
+
+	// the writers of the key being opened wait for it
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := r.WriteKey("slow", []byte("a\n"))
+			assert.Nil(t, err)
+		}()
+	}
+	<-fs.entered
+
+	// the other keys are written meanwhile
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.WriteKey("fast", []byte("b\n"))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("write blocked by the open of another key")
+	}
+
+	close(fs.gate)
+	wg.Wait()
+	r.Close()
+	assert.Equal(t, int32(1), fs.opens.Load())
+	b, _ := mem.ReadFile("/logs/slow.log")
+	assert.Equal(t, "a\na\n", string(b))
+}
+
+func TestRoutingWriterPolicy(t *testing.T) {
+	cfg := NewDefaultConfig()
+	cfg.FilePath = "/logs/{key}.log"
+	cfg.FileSystem = NewMemFS()
+	cfg.RotationPolicy = &everyNRecords{n: 2}
+	_, err := NewRoutingWriter(RouterConfig{Template: cfg})
+	assert.Equal(t, ErrInvalidArgument, err)
+
+	// every file gets its own policy
+	cfg.RotationPolicy = nil
+	policies := make(map[string]*everyNRecords)
+	r, err := NewRoutingWriter(RouterConfig{
+		Template: cfg,
+		NewRotationPolicy: func(key string) RotationPolicy {
+			policies[key] = &everyNRecords{n: 2}
+			return policies[key]
+		},
+	})
+	assert.Nil(t, err)
+	r.WriteKey("a", []byte("a\n"))
+	r.WriteKey("b", []byte("b\n"))
+	r.Close()
+	assert.Equal(t, 2, len(policies))
+	assert.True(t, policies["a"].stopped)
+	assert.True(t, policies["b"].stopped)
+}
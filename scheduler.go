@@ -0,0 +1,204 @@
+package rollingwriter
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron"
+)
+
+// scheduler runs cron style jobs for any number of managers on a single
+// go routine, unlike cron.Cron it allows the jobs to be removed again
+type scheduler struct {
+	entries map[int]*schedEntry
+	nextID  int
+	clock   Clock
+	wakeCh  chan struct{}
+	doneCh  chan struct{}
+	once    sync.Once
+	lock    sync.Mutex
+}
+
+type schedEntry struct {
+	schedule cron.Schedule
+	next     time.Time
+	fn       func()
+}
+
+func newScheduler(clock Clock) *scheduler {
+	s := &scheduler{
+		entries: make(map[int]*schedEntry),
+		clock:   clock,
+		wakeCh:  make(chan struct{}, 1),
+		doneCh:  make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// schedule registers fn to be run on the given schedule and returns its id
+func (s *scheduler) schedule(schedule cron.Schedule, fn func()) int {
+	s.lock.Lock()
+	s.nextID++
+	id := s.nextID
+	s.entries[id] = &schedEntry{
+		schedule: schedule,
+		next:     schedule.Next(s.clock.Now()),
+		fn:       fn,
+	}
+	s.lock.Unlock()
+	s.wake()
+	return id
+}
+
+// remove unregisters the job, no new run is started after remove returns
+func (s *scheduler) remove(id int) {
+	s.lock.Lock()
+	delete(s.entries, id)
+	s.lock.Unlock()
+	s.wake()
+}
+
+// stop the scheduler go routine
+func (s *scheduler) stop() {
+	s.once.Do(func() { close(s.doneCh) })
+}
+
+func (s *scheduler) wake() {
+	select {
+	case s.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+func (s *scheduler) run() {
+	var timer Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		now := s.clock.Now()
+		s.lock.Lock()
+		// run the due jobs and find out when the next one is due
+		var next time.Time
+		for _, e := range s.entries {
+			if !e.next.After(now) {
+				go e.fn()
+				e.next = e.schedule.Next(now)
+			}
+			if !e.next.IsZero() && (next.IsZero() || e.next.Before(next)) {
+				next = e.next
+			}
+		}
+		s.lock.Unlock()
+
+		wait := time.Hour
+		if !next.IsZero() {
+			wait = next.Sub(now)
+		}
+		if timer == nil {
+			timer = s.clock.NewTimer(wait)
+		} else {
+			if !timer.Stop() {
+				select {
+				case <-timer.C():
+				default:
+				}
+			}
+			timer.Reset(wait)
+		}
+
+		select {
+		case <-s.doneCh:
+			return
+		case <-s.wakeCh:
+		case <-timer.C():
+		}
+	}
+}
+
+// locSchedule runs a cron schedule on the wall clock of a location. The
+// schedule is computed on the wall clock as if there was no DST and mapped
+// back to the location, so a time skipped when the clocks go forward fires
+// when the gap ends and a time repeated when they go back fires once
+type locSchedule struct {
+	schedule cron.Schedule
+	loc      *time.Location
+}
+
+func inLocation(schedule cron.Schedule, loc *time.Location) cron.Schedule {
+	return &locSchedule{schedule: schedule, loc: loc}
+}
+
+func (s *locSchedule) Next(t time.Time) time.Time {
+	wall := wallClock(t.In(s.loc), time.UTC)
+	for {
+		if wall = s.schedule.Next(wall); wall.IsZero() {
+			return wall
+		}
+		next := wallClock(wall, s.loc)
+		if !wallClock(next, time.UTC).Equal(wall) {
+			// the wall clock is in a DST gap, fire when the gap ends
+			_, next = next.ZoneBounds()
+		}
+		if next.After(t) {
+			return next
+		}
+	}
+}
+
+// wallClock returns the time with the same wall clock as t in loc
+func wallClock(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+// intervalSchedule fires at the wall clock times which are multiples of the
+// interval, midnight included if the interval divides a day. It is meant to
+// run on the wall clock with inLocation
+type intervalSchedule time.Duration
+
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	return t.Truncate(time.Duration(s)).Add(time.Duration(s))
+}
+
+// timeSchedule returns the TimeRolling schedule of the config
+func timeSchedule(c *Config) (cron.Schedule, error) {
+	if c.RollingInterval == "" {
+		return cron.Parse(c.RollingTimePattern)
+	}
+	interval, err := parseInterval(c.RollingInterval)
+	if err != nil {
+		return nil, err
+	}
+	return intervalSchedule(interval), nil
+}
+
+// parseInterval parses a RollingInterval
+func parseInterval(interval string) (time.Duration, error) {
+	var d time.Duration
+	switch interval {
+	case "hourly":
+		d = time.Hour
+	case "daily":
+		d = 24 * time.Hour
+	default:
+		var err error
+		if d, err = time.ParseDuration(interval); err != nil {
+			return 0, fmt.Errorf("%w: rolling interval %s", ErrInvalidArgument, interval)
+		}
+	}
+	if d < time.Second {
+		return 0, fmt.Errorf("%w: rolling interval %s", ErrInvalidArgument, interval)
+	}
+	return d, nil
+}
+
+// periodStart returns the start of the interval period t belongs to
+func periodStart(t time.Time, interval time.Duration, loc *time.Location) time.Time {
+	wall := wallClock(t.In(loc), time.UTC).Truncate(interval)
+	return wallClock(wall, loc)
+}
@@ -0,0 +1,91 @@
+package rollingwriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/robfig/cron"
+	"github.com/stretchr/testify/assert"
+)
+
+type everySchedule time.Duration
+
+func (s everySchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+func TestScheduler(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := newScheduler(clock)
+	defer s.stop()
+
+	fired := make(chan int, 16)
+	one := s.schedule(everySchedule(time.Minute), func() { fired <- 1 })
+	s.schedule(everySchedule(time.Hour), func() { fired <- 2 })
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	assert.Equal(t, 1, <-fired)
+
+	// the removed job does not run anymore
+	s.remove(one)
+	clock.BlockUntil(1)
+	clock.Advance(time.Hour)
+	assert.Equal(t, 2, <-fired)
+	assert.Equal(t, 0, len(fired))
+}
+
+func TestLocationSchedule(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	assert.Nil(t, err)
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	assert.Nil(t, err)
+
+	daily, _ := cron.Parse("0 0 0 * * *")
+	next := inLocation(daily, kolkata).Next(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2024, 1, 1, 18, 30, 0, 0, time.UTC), next.UTC())
+
+	// 02:30 does not exist on 2024-03-10, it fires when the gap ends
+	spring, _ := cron.Parse("0 30 2 * * *")
+	s := inLocation(spring, ny)
+	next = s.Next(time.Date(2024, 3, 9, 3, 0, 0, 0, ny))
+	assert.Equal(t, time.Date(2024, 3, 10, 3, 0, 0, 0, ny), next)
+	next = s.Next(next)
+	assert.Equal(t, time.Date(2024, 3, 11, 2, 30, 0, 0, ny), next)
+
+	// 01:30 happens twice on 2024-11-03, it fires once
+	fall, _ := cron.Parse("0 30 1 * * *")
+	s = inLocation(fall, ny)
+	next = s.Next(time.Date(2024, 11, 3, 0, 0, 0, 0, ny))
+	assert.Equal(t, 3, next.Day())
+	next = s.Next(next)
+	assert.Equal(t, time.Date(2024, 11, 4, 1, 30, 0, 0, ny), next)
+}
+
+func TestIntervalSchedule(t *testing.T) {
+	kolkata, _ := time.LoadLocation("Asia/Kolkata")
+	c := &Config{RollingPolicy: TimeRolling, RollingInterval: "15m", Location: kolkata}
+	schedule, err := timeSchedule(c)
+	assert.Nil(t, err)
+	s := inLocation(schedule, kolkata)
+	next := s.Next(time.Date(2024, 1, 1, 10, 7, 0, 0, kolkata))
+	assert.Equal(t, time.Date(2024, 1, 1, 10, 15, 0, 0, kolkata), next)
+	next = s.Next(next)
+	assert.Equal(t, time.Date(2024, 1, 1, 10, 30, 0, 0, kolkata), next)
+
+	c.RollingInterval = "daily"
+	schedule, _ = timeSchedule(c)
+	next = inLocation(schedule, kolkata).Next(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2024, 1, 2, 0, 0, 0, 0, kolkata), next)
+
+	// backups are tagged with the start of their period
+	c.FilePath = "./app.log"
+	c.TimeTagFormat = "200601021504"
+	c.RollingInterval = "hourly"
+	assert.Equal(t, "app.log.202401011000", backupFileName(c, time.Date(2024, 1, 1, 10, 17, 0, 0, kolkata)))
+
+	for _, interval := range []string{"weekly", "10ms", "-1h"} {
+		_, err = parseInterval(interval)
+		assert.ErrorIs(t, err, ErrInvalidArgument)
+	}
+}
@@ -0,0 +1,141 @@
+package rollingwriter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+)
+
+// SlogOptions give out the options of a SlogHandler
+type SlogOptions struct {
+	slog.HandlerOptions
+
+	// JSON encodes the records with slog.JSONHandler instead of the
+	// default slog.TextHandler
+	JSON bool
+
+	// ErrorConfig is the config of a separate rolling file receiving the
+	// records at or above ErrorLevel, they are not written to the main file
+	ErrorConfig *Config
+
+	// ErrorLevel defaults to slog.LevelError
+	ErrorLevel slog.Leveler
+}
+
+// SlogHandler is a slog.Handler writing the records to rolling files
+type SlogHandler struct {
+	handler    slog.Handler
+	errHandler slog.Handler
+	errLevel   slog.Leveler
+	writers    []RollingWriter
+}
+
+// NewSlogHandler generate the SlogHandler writing to a rolling file with
+// the given config
+func NewSlogHandler(c *Config, opts *SlogOptions) (*SlogHandler, error) {
+	if opts == nil {
+		opts = &SlogOptions{}
+	}
+
+	w, err := NewWriterFromConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	h := &SlogHandler{
+		handler:  opts.newHandler(w),
+		errLevel: opts.ErrorLevel,
+		writers:  []RollingWriter{w},
+	}
+	if h.errLevel == nil {
+		h.errLevel = slog.LevelError
+	}
+
+	if opts.ErrorConfig != nil {
+		errw, err := NewWriterFromConfig(opts.ErrorConfig)
+		if err != nil {
+			w.Close()
+			return nil, err
+		}
+		h.errHandler = opts.newHandler(errw)
+		h.writers = append(h.writers, errw)
+	}
+	return h, nil
+}
+
+func (o *SlogOptions) newHandler(w io.Writer) slog.Handler {
+	// slog reuses its encoding buffer once Write returns while the rolling
+	// writer keeps the record queued until it reaches the file, so every
+	// record is copied into a pooled buffer
+	cw := &copyWriter{w: w}
+	if o.JSON {
+		return slog.NewJSONHandler(cw, &o.HandlerOptions)
+	}
+	return slog.NewTextHandler(cw, &o.HandlerOptions)
+}
+
+// Enabled reports whether the handler handles records at the given level
+func (h *SlogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if h.errHandler != nil && level >= h.errLevel.Level() {
+		return h.errHandler.Enabled(ctx, level)
+	}
+	return h.handler.Enabled(ctx, level)
+}
+
+// Handle writes the record to the error file if it is configured and the
+// record level is high enough, to the main file otherwise
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	if h.errHandler != nil && r.Level >= h.errLevel.Level() {
+		return h.errHandler.Handle(ctx, r)
+	}
+	return h.handler.Handle(ctx, r)
+}
+
+// WithAttrs returns a handler sharing the rolling files of h
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.handler = h.handler.WithAttrs(attrs)
+	if h.errHandler != nil {
+		h2.errHandler = h.errHandler.WithAttrs(attrs)
+	}
+	return &h2
+}
+
+// WithGroup returns a handler sharing the rolling files of h
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	h2 := *h
+	h2.handler = h.handler.WithGroup(name)
+	if h.errHandler != nil {
+		h2.errHandler = h.errHandler.WithGroup(name)
+	}
+	return &h2
+}
+
+// Close flushes and closes the rolling files, the handlers derived from h
+// with WithAttrs and WithGroup can not be used afterwards
+func (h *SlogHandler) Close() error {
+	var errs []error
+	for _, w := range h.writers {
+		if err := w.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// copyWriter passes a copy of every message to w, for callers reusing
+// their buffer after Write returns. The copies given to an asynchronous
+// Writer are pooled, the writer recycles them once written
+type copyWriter struct {
+	w io.Writer
+}
+
+func (c *copyWriter) Write(b []byte) (int, error) {
+	if w, ok := c.w.(*Writer); ok && !w.conf.Synchronous {
+		buf := w.ownedBuffer(len(b))
+		copy(buf, b)
+		return w.writeOwned(buf)
+	}
+	return c.w.Write(bytes.Clone(b))
+}
@@ -0,0 +1,75 @@
+package rollingwriter
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlogHandler(t *testing.T) {
+	cfg := NewDefaultConfig()
+	cfg.FilePath = "./test/slog/app.log"
+	errCfg := NewDefaultConfig()
+	errCfg.FilePath = "./test/slog/error.log"
+
+	h, err := NewSlogHandler(&cfg, &SlogOptions{JSON: true, ErrorConfig: &errCfg})
+	assert.Nil(t, err)
+	logger := slog.New(h).With("app", "test")
+	for i := range 100 {
+		logger.Info("hello", "i", i)
+	}
+	logger.Error("failed")
+	assert.Nil(t, h.Close())
+
+	b, _ := os.ReadFile(cfg.FilePath)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	assert.Equal(t, 100, len(lines))
+	// every record is intact although slog reuses its buffers
+	for _, line := range lines {
+		assert.True(t, strings.HasPrefix(line, `{"time":`))
+		assert.Contains(t, line, `"msg":"hello","app":"test"`)
+	}
+	b, _ = os.ReadFile(errCfg.FilePath)
+	assert.Contains(t, string(b), `"level":"ERROR","msg":"failed","app":"test"`)
+	os.RemoveAll("./test/slog")
+	clean()
+}
+
+func TestSlogHandlerBadPath(t *testing.T) {
+	// the directory of the log file is a file
+	os.MkdirAll("./test", 0755)
+	os.WriteFile("./test/notdir", nil, 0644)
+	cfg := NewDefaultConfig()
+	cfg.FilePath = "./test/notdir/app.log"
+
+	h, err := NewSlogHandler(&cfg, nil)
+	assert.Nil(t, h)
+	assert.NotNil(t, err)
+	os.Remove("./test/notdir")
+	clean()
+}
+
+func TestCopyWriterPool(t *testing.T) {
+	mem := NewMemFS()
+	w, _ := NewWriter(WithFileSystem(mem), WithFilePath("/logs/app.log"))
+	writer := w.(*Writer)
+	cw := &copyWriter{w: w}
+
+	// the caller reuses its buffer, the copy is recycled once written
+	b := []byte("hello\n")
+	cw.Write(b)
+	copy(b, "world\n")
+	assert.Nil(t, writer.Sync())
+	assert.Equal(t, 1, len(writer.recycled))
+
+	cw.Write(b)
+	assert.Equal(t, 0, len(writer.recycled))
+	assert.Nil(t, writer.Sync())
+	assert.Equal(t, 1, len(writer.recycled))
+	got, _ := mem.ReadFile("/logs/app.log")
+	assert.Equal(t, "hello\nworld\n", string(got))
+	w.Close()
+}
@@ -0,0 +1,258 @@
+package rollingwriter
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Error phases of Stats.ErrorsByPhase
+const (
+	PhaseWrite    = "write"
+	PhaseSync     = "sync"
+	PhaseRotate   = "rotate"
+	PhaseCompress = "compress"
+	PhasePrune    = "prune"
+)
+
+type errPhase int
+
+const (
+	phaseWrite errPhase = iota
+	phaseSync
+	phaseRotate
+	phaseCompress
+	phasePrune
+	numPhases
+)
+
+var phaseNames = [numPhases]string{PhaseWrite, PhaseSync, PhaseRotate, PhaseCompress, PhasePrune}
+
+// numReasons is the number of built in rotation reasons
+const numReasons = int(RotationIdle) + 1
+
+// Stats give out a snapshot of the writer counters and gauges
+type Stats struct {
+	// Records and Bytes are the log messages accepted by Write
+	Records uint64 `json:"records"`
+	Bytes   uint64 `json:"bytes"`
+	// RecordsWritten is the number of records taken off the queue by the
+	// writer go routine
+	RecordsWritten uint64 `json:"records_written"`
+	// BytesWritten is the number of bytes written to the log files
+	BytesWritten uint64 `json:"bytes_written"`
+	// QueueDepth is the number of records waiting in the queue of
+	// QueueSize records, or in the batch waiting for the file
+	QueueDepth int `json:"queue_depth"`
+	QueueSize  int `json:"queue_size"`
+	// Flushes is the number of buffer writes to the file
+	Flushes uint64 `json:"flushes"`
+	// DirectWrites is the number of records too big for the buffer which
+	// were written to the file directly
+	DirectWrites uint64 `json:"direct_writes"`
+	// Rotations is the number of completed file rotations
+	Rotations uint64 `json:"rotations"`
+	// RotationsByReason counts the rotations by RotationReason name
+	RotationsByReason map[string]uint64 `json:"rotations_by_reason,omitempty"`
+	// LastRotation is the time the last rotation completed, RotationLag
+	// is how long after it was triggered
+	LastRotation time.Time     `json:"last_rotation"`
+	RotationLag  time.Duration `json:"rotation_lag"`
+	// Compressions is the number of compressed backups, taking
+	// CompressionTime in total and MaxCompressionTime at most
+	Compressions       uint64        `json:"compressions"`
+	CompressionTime    time.Duration `json:"compression_time"`
+	MaxCompressionTime time.Duration `json:"max_compression_time"`
+	// Commits is the number of flushes acknowledging synchronous writes,
+	// CommittedRecords is the number of records they acknowledged and
+	// MaxCommitRecords the largest batch
+	Commits          uint64 `json:"commits"`
+	CommittedRecords uint64 `json:"committed_records"`
+	MaxCommitRecords uint64 `json:"max_commit_records"`
+	// CommitTime is the time spent writing and syncing the commits, taking
+	// MaxCommitTime at most
+	CommitTime    time.Duration `json:"commit_time"`
+	MaxCommitTime time.Duration `json:"max_commit_time"`
+	// Errors is the number of failed writes, syncs, rotations,
+	// compressions and prunes
+	Errors uint64 `json:"errors"`
+	// ErrorsByPhase counts the errors by phase, see PhaseWrite
+	ErrorsByPhase map[string]uint64 `json:"errors_by_phase,omitempty"`
+	// Dropped is the number of records lost to failed writes or left in
+	// the queue when the writer was closed
+	Dropped uint64 `json:"dropped"`
+	// DroppedEvents is the number of rotation events a subscriber had no
+	// room for
+	DroppedEvents uint64 `json:"dropped_events"`
+}
+
+// Add accumulates the counters of o into s, the gauges are summed too
+// except the last rotation and the largest lag, times and batch which are
+// kept
+func (s *Stats) Add(o Stats) {
+	s.Records += o.Records
+	s.Bytes += o.Bytes
+	s.RecordsWritten += o.RecordsWritten
+	s.BytesWritten += o.BytesWritten
+	s.QueueDepth += o.QueueDepth
+	s.QueueSize += o.QueueSize
+	s.Flushes += o.Flushes
+	s.DirectWrites += o.DirectWrites
+	s.Rotations += o.Rotations
+	s.RotationsByReason = addCounts(s.RotationsByReason, o.RotationsByReason)
+	if o.LastRotation.After(s.LastRotation) {
+		s.LastRotation = o.LastRotation
+	}
+	s.RotationLag = max(s.RotationLag, o.RotationLag)
+	s.Compressions += o.Compressions
+	s.CompressionTime += o.CompressionTime
+	s.MaxCompressionTime = max(s.MaxCompressionTime, o.MaxCompressionTime)
+	s.Commits += o.Commits
+	s.CommittedRecords += o.CommittedRecords
+	s.MaxCommitRecords = max(s.MaxCommitRecords, o.MaxCommitRecords)
+	s.CommitTime += o.CommitTime
+	s.MaxCommitTime = max(s.MaxCommitTime, o.MaxCommitTime)
+	s.Errors += o.Errors
+	s.ErrorsByPhase = addCounts(s.ErrorsByPhase, o.ErrorsByPhase)
+	s.Dropped += o.Dropped
+	s.DroppedEvents += o.DroppedEvents
+}
+
+func addCounts(dst, src map[string]uint64) map[string]uint64 {
+	if len(src) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[string]uint64, len(src))
+	}
+	for k, v := range src {
+		dst[k] += v
+	}
+	return dst
+}
+
+// writerStats holds the live counters, they are updated from the callers
+// of Write, the writer go routine and the compression jobs
+type writerStats struct {
+	recordsWritten  atomic.Uint64
+	bytesWritten    atomic.Uint64
+	flushes         atomic.Uint64
+	directWrites    atomic.Uint64
+	rotations       atomic.Uint64
+	reasons         [numReasons]atomic.Uint64
+	otherReasons    atomic.Uint64
+	lastRotation    atomic.Int64
+	rotationLag     atomic.Int64
+	compressions    atomic.Uint64
+	compressionTime atomic.Int64
+	maxCompression  atomic.Int64
+	commits         atomic.Uint64
+	committed       atomic.Uint64
+	maxCommitted    atomic.Int64
+	commitTime      atomic.Int64
+	maxCommitTime   atomic.Int64
+	errors          [numPhases]atomic.Uint64
+	dropped         atomic.Uint64
+}
+
+func (s *writerStats) written(n int64, err error) {
+	if n > 0 {
+		s.bytesWritten.Add(uint64(n))
+	}
+	if err != nil {
+		s.failed(phaseWrite)
+	}
+}
+
+func (s *writerStats) failed(phase errPhase) {
+	s.errors[phase].Add(1)
+}
+
+func (s *writerStats) rotated(reason RotationReason, triggeredAt, now time.Time) {
+	s.rotations.Add(1)
+	s.lastRotation.Store(now.UnixNano())
+	if !triggeredAt.IsZero() {
+		s.rotationLag.Store(int64(now.Sub(triggeredAt)))
+	}
+	if reason >= 0 && int(reason) < numReasons {
+		s.reasons[reason].Add(1)
+	} else {
+		s.otherReasons.Add(1)
+	}
+}
+
+func (s *writerStats) compressed(d time.Duration) {
+	s.compressions.Add(1)
+	s.compressionTime.Add(int64(d))
+	storeMax(&s.maxCompression, int64(d))
+}
+
+func (s *writerStats) committedBatch(records int, d time.Duration) {
+	s.commits.Add(1)
+	s.committed.Add(uint64(records))
+	storeMax(&s.maxCommitted, int64(records))
+	s.commitTime.Add(int64(d))
+	storeMax(&s.maxCommitTime, int64(d))
+}
+
+// storeMax stores v in m if it is larger than the value of m
+func storeMax(m *atomic.Int64, v int64) {
+	for {
+		prev := m.Load()
+		if v <= prev || m.CompareAndSwap(prev, v) {
+			return
+		}
+	}
+}
+
+func (s *writerStats) snapshot() Stats {
+	stats := Stats{
+		RecordsWritten:     s.recordsWritten.Load(),
+		BytesWritten:       s.bytesWritten.Load(),
+		Flushes:            s.flushes.Load(),
+		DirectWrites:       s.directWrites.Load(),
+		Rotations:          s.rotations.Load(),
+		RotationLag:        time.Duration(s.rotationLag.Load()),
+		Compressions:       s.compressions.Load(),
+		CompressionTime:    time.Duration(s.compressionTime.Load()),
+		MaxCompressionTime: time.Duration(s.maxCompression.Load()),
+		Commits:            s.commits.Load(),
+		CommittedRecords:   s.committed.Load(),
+		MaxCommitRecords:   uint64(s.maxCommitted.Load()),
+		CommitTime:         time.Duration(s.commitTime.Load()),
+		MaxCommitTime:      time.Duration(s.maxCommitTime.Load()),
+		Dropped:            s.dropped.Load(),
+	}
+	if stats.Rotations > 0 {
+		stats.LastRotation = time.Unix(0, s.lastRotation.Load())
+		stats.RotationsByReason = make(map[string]uint64)
+		for i := range s.reasons {
+			if n := s.reasons[i].Load(); n > 0 {
+				stats.RotationsByReason[RotationReason(i).String()] = n
+			}
+		}
+		if n := s.otherReasons.Load(); n > 0 {
+			stats.RotationsByReason["other"] = n
+		}
+	}
+	for i := range s.errors {
+		if n := s.errors[i].Load(); n > 0 {
+			if stats.ErrorsByPhase == nil {
+				stats.ErrorsByPhase = make(map[string]uint64)
+			}
+			stats.Errors += n
+			stats.ErrorsByPhase[phaseNames[i]] = n
+		}
+	}
+	return stats
+}
+
+// Stats returns a snapshot of the writer counters, it is safe to call
+// while the writer is running
+func (w *Writer) Stats() Stats {
+	stats := w.stats.snapshot()
+	stats.Records, stats.Bytes = w.queue.pushed()
+	stats.QueueDepth = w.queue.len() + int(w.held.Load())
+	stats.QueueSize = w.queue.cap()
+	stats.DroppedEvents = w.events.dropped.Load()
+	return stats
+}
@@ -0,0 +1,67 @@
+package rollingwriter
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	mem := NewMemFS()
+	faults := NewFaultFS(mem)
+	cfg := NewDefaultConfig()
+	cfg.FilePath = "/logs/app.log"
+	cfg.QueueSize = 128
+	WithCompress()(&cfg)
+	WithFileSystem(faults)(&cfg)
+	WithClock(NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)))(&cfg)
+	pool := newCompressPool(1)
+	// driven without the writer go routine
+	writer, _ := createWriter(&cfg, nil, pool)
+	writer.openFile()
+
+	writer.process([]byte("hello\n"))
+	writer.process([]byte("world\n"))
+	writer.flush()
+	writer.process(make([]byte, cfg.BufferSize))
+	writer.rotate(RotationTrigger{Reason: RotationManual})
+	writer.process([]byte("hello\n"))
+	writer.rotate(RotationTrigger{Reason: RotationSize})
+
+	// the buffered records are lost with a failed write
+	faults.Inject(Fault{Op: OpWrite, Path: "app.log", Err: syscall.ENOSPC, Times: 1})
+	writer.process([]byte("a\n"))
+	writer.process([]byte("b\n"))
+	writer.flush()
+	faults.Inject(Fault{Op: OpRename, Err: syscall.EXDEV, Times: 1})
+	writer.rotate(RotationTrigger{Reason: RotationManual})
+	pool.close()
+
+	stats := writer.Stats()
+	assert.Equal(t, uint64(6), stats.RecordsWritten)
+	assert.Equal(t, uint64(18+cfg.BufferSize), stats.BytesWritten)
+	assert.Equal(t, 0, stats.QueueDepth)
+	assert.Equal(t, 128, stats.QueueSize)
+	// the direct write goes out with its own flush
+	assert.Equal(t, uint64(4), stats.Flushes)
+	assert.Equal(t, uint64(1), stats.DirectWrites)
+	assert.Equal(t, uint64(2), stats.Rotations)
+	assert.Equal(t, map[string]uint64{"manual": 1, "size": 1}, stats.RotationsByReason)
+	assert.Equal(t, uint64(2), stats.Compressions)
+	assert.True(t, stats.MaxCompressionTime > 0)
+	assert.True(t, stats.CompressionTime >= stats.MaxCompressionTime)
+	assert.Equal(t, uint64(2), stats.Errors)
+	assert.Equal(t, map[string]uint64{PhaseWrite: 1, PhaseRotate: 1}, stats.ErrorsByPhase)
+	assert.Equal(t, uint64(2), stats.Dropped)
+
+	var total Stats
+	total.Add(stats)
+	total.Add(stats)
+	assert.Equal(t, map[string]uint64{"manual": 2, "size": 2}, total.RotationsByReason)
+	assert.Equal(t, stats.MaxCompressionTime, total.MaxCompressionTime)
+	assert.Equal(t, uint64(4), total.Dropped)
+	writer.closeFile()
+	writer.monitor.Close()
+}
@@ -0,0 +1,396 @@
+package rollingwriter
+
+import (
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SinkTimeout is how long a TeeWriter waits for a sink to take the next
+// messages before dropping them for it
+var SinkTimeout = 2 * time.Second
+
+// Sink is a destination of a TeeWriter, either a rolling file given by
+// Config or a plain io.Writer like os.Stderr
+type Sink struct {
+	Config *Config
+	Writer io.Writer
+}
+
+// FileSink returns a rolling file Sink with the given config
+func FileSink(c *Config) Sink {
+	return Sink{Config: c}
+}
+
+// WriterSink returns a Sink writing every message to w
+func WriterSink(w io.Writer) Sink {
+	return Sink{Writer: w}
+}
+
+// TeeWriter writes every message to several sinks. The messages are
+// enqueued once and a go routine dispatches them in batches to the sinks,
+// which write them in their own go routine. Write waits for room in the
+// queue while the sinks are behind, but a sink still busy after
+// SinkTimeout is stalled: its messages are dropped until it catches up so
+// that it does not stop the others, see Dropped
+type TeeWriter struct {
+	files     []*Writer
+	sinks     []*teeSink
+	queue     *queue
+	cur       *batch
+	timeout   time.Duration
+	timer     *time.Timer
+	healthy   atomic.Int32
+	sched     *scheduler
+	syncCh    chan chan error
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+// teeSink takes the batches of a sink on in and gives them back on back
+// once written. The I/O go routine of the file writer serves a file sink
+type teeSink struct {
+	in      chan ioRequest
+	back    chan *batch
+	free    *batch
+	stalled bool
+	file    *Writer
+	dropped *atomic.Uint64
+}
+
+// NewTeeWriter generate the TeeWriter for the given sinks, the queue size
+// is the largest QueueSize of the file sinks configs
+func NewTeeWriter(sinks ...Sink) (RollingWriter, error) {
+	t := &TeeWriter{
+		sched:   newScheduler(systemClock{}),
+		cur:     &batch{},
+		timeout: SinkTimeout,
+		syncCh:  make(chan chan error),
+		stopped: make(chan struct{}),
+	}
+
+	queueSize := 0
+	var err error
+	for _, sink := range sinks {
+		switch {
+		case sink.Config != nil:
+			var w *Writer
+			if w, err = createWriter(sink.Config, t.sched, nil); err != nil {
+				break
+			}
+			if err = w.startIOLoop(); err != nil {
+				w.monitor.Close()
+				break
+			}
+			t.files = append(t.files, w)
+			t.sinks = append(t.sinks, &teeSink{in: w.ioCh, back: w.spare, file: w, dropped: &w.stats.dropped})
+			queueSize = max(queueSize, sink.Config.QueueSize)
+		case sink.Writer != nil:
+			s := &teeSink{in: make(chan ioRequest), back: make(chan *batch, 1), dropped: new(atomic.Uint64)}
+			s.back <- &batch{}
+			go s.writeLoop(sink.Writer)
+			t.sinks = append(t.sinks, s)
+		default:
+			err = ErrInvalidArgument
+		}
+		if err != nil {
+			t.stop()
+			return nil, err
+		}
+	}
+	if queueSize == 0 {
+		queueSize = DefaultQueueSize
+	}
+
+	// the file sinks report the messages enqueued once for all
+	t.queue = newQueue(queueSize)
+	for _, w := range t.files {
+		w.queue = t.queue
+	}
+	t.healthy.Store(int32(len(t.sinks)))
+	t.timer = time.NewTimer(t.timeout)
+	t.timer.Stop()
+	go t.loop()
+	return t, nil
+}
+
+// writeLoop writes the batches of an io.Writer sink until it is stopped,
+// it syncs the writer if it is a Syncer like os.File
+func (s *teeSink) writeLoop(w io.Writer) {
+	for req := range s.in {
+		switch {
+		case req.stop != nil:
+			close(req.stop)
+			return
+		case req.sync != nil:
+			var err error
+			if syncer, ok := w.(Syncer); ok {
+				isolate("sync", func() { err = syncer.Sync() })
+			}
+			req.sync <- err
+			continue
+		}
+		for _, data := range req.batch.msgs {
+			isolate("write", func() {
+				if n, err := w.Write(data); err != nil {
+					log.Println("Sink write", n, err)
+				}
+			})
+		}
+		clear(req.batch.msgs)
+		req.batch.msgs = req.batch.msgs[:0]
+		req.batch.size = 0
+		s.back <- req.batch
+	}
+}
+
+// loop dispatches the queued messages to the sinks, and checks whether the
+// stalled sinks caught up
+func (t *TeeWriter) loop() {
+	ticker := time.NewTicker(t.timeout)
+	defer ticker.Stop()
+
+	for {
+		t.queue.drain(t.collect)
+		if len(t.cur.msgs) > 0 {
+			t.dispatch()
+		}
+		select {
+		case <-t.queue.wait():
+		case done := <-t.syncCh:
+			// the messages queued before Sync was called are synced too
+			for t.queue.drain(t.collect) > 0 {
+				t.dispatch()
+			}
+			done <- t.sync()
+		case <-ticker.C:
+			for _, s := range t.sinks {
+				if s.stalled {
+					t.catchUp(s)
+				}
+			}
+		case <-t.queue.done:
+			// Stopping write, the messages still queued are written first
+			for t.queue.drain(t.collect) > 0 {
+				t.dispatch()
+			}
+			t.stop()
+			close(t.stopped)
+			return
+		}
+	}
+}
+
+func (t *TeeWriter) collect(data []byte, _ chan error) {
+	t.cur.msgs = append(t.cur.msgs, data)
+	t.cur.size += len(data)
+}
+
+// dispatch passes the current batch to every sink, the messages are
+// dropped for the stalled sinks
+func (t *TeeWriter) dispatch() {
+	for _, s := range t.sinks {
+		if !t.send(s, t.cur) {
+			s.dropped.Add(uint64(len(t.cur.msgs)))
+		}
+	}
+	clear(t.cur.msgs)
+	t.cur.msgs = t.cur.msgs[:0]
+	t.cur.size = 0
+}
+
+// send hands the messages of b to the sink once it gave back its previous
+// batch. It waits for the sink up to the timeout, a stalled sink is not
+// waited for. It reports whether the sink took the messages
+func (t *TeeWriter) send(s *teeSink, b *batch) bool {
+	if s.stalled && !t.catchUp(s) {
+		return false
+	}
+	if s.free == nil {
+		select {
+		case s.free = <-s.back:
+		case <-t.wait():
+			t.stall(s)
+			return false
+		}
+	}
+
+	s.free.msgs = append(s.free.msgs, b.msgs...)
+	s.free.size = b.size
+	if s.file != nil {
+		s.file.held.Add(int64(len(b.msgs)))
+	}
+	select {
+	case s.in <- ioRequest{batch: s.free}:
+		s.free = nil
+		return true
+	case <-t.wait():
+		if s.file != nil {
+			s.file.held.Add(-int64(len(b.msgs)))
+		}
+		clear(s.free.msgs)
+		s.free.msgs = s.free.msgs[:0]
+		s.free.size = 0
+		t.stall(s)
+		return false
+	}
+}
+
+// sync syncs every sink after the messages dispatched to it, a stalled
+// sink fails it
+func (t *TeeWriter) sync() error {
+	var errs []error
+	for _, s := range t.sinks {
+		if s.stalled && !t.catchUp(s) {
+			errs = append(errs, ErrSinkStalled)
+			continue
+		}
+		done := make(chan error, 1)
+		select {
+		case s.in <- ioRequest{sync: done}:
+		case <-t.wait():
+			t.stall(s)
+			errs = append(errs, ErrSinkStalled)
+			continue
+		}
+		select {
+		case err := <-done:
+			if err != nil {
+				errs = append(errs, err)
+			}
+		case <-t.wait():
+			t.stall(s)
+			errs = append(errs, ErrSinkStalled)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// wait returns the channel ready once the sink timeout elapsed
+func (t *TeeWriter) wait() <-chan time.Time {
+	t.timer.Reset(t.timeout)
+	return t.timer.C
+}
+
+// stall marks the sink as stalled
+func (t *TeeWriter) stall(s *teeSink) {
+	if !s.stalled {
+		s.stalled = true
+		t.healthy.Add(-1)
+		log.Println("Sink stalled, dropping its messages")
+	}
+}
+
+// catchUp takes the batch given back by a stalled sink, the sink is no
+// more stalled then. It reports whether the sink caught up
+func (t *TeeWriter) catchUp(s *teeSink) bool {
+	if s.free == nil {
+		select {
+		case s.free = <-s.back:
+		default:
+			return false
+		}
+	}
+	s.stalled = false
+	t.healthy.Add(1)
+	log.Println("Sink caught up")
+	return true
+}
+
+// stop closes the sinks, a sink still busy after the close timeout is left
+// behind. The stalled sinks are not waited for unless they caught up
+func (t *TeeWriter) stop() {
+	timeout := time.After(4 * time.Second)
+	for _, s := range t.sinks {
+		if s.stalled && !t.catchUp(s) {
+			log.Println("Sink stalled on close")
+			continue
+		}
+		stopped := make(chan struct{})
+		select {
+		case s.in <- ioRequest{stop: stopped}:
+			select {
+			case <-stopped:
+			case <-timeout:
+				log.Println("Sink close timeout")
+			}
+		case <-timeout:
+			log.Println("Sink close timeout")
+		}
+	}
+	for _, w := range t.files {
+		w.cancel()
+		w.monitor.Close()
+	}
+	t.sched.stop()
+}
+
+// Write enqueues the message for all the sinks, waiting for room in the
+// queue if it is full. It returns ErrSinkStalled if every sink is stalled,
+// and ErrClosed once the writer is closed
+func (t *TeeWriter) Write(b []byte) (int, error) {
+	if t.healthy.Load() == 0 && !t.queue.closed.Load() {
+		for _, s := range t.sinks {
+			s.dropped.Add(1)
+		}
+		return 0, ErrSinkStalled
+	}
+	if !t.queue.push(b, nil) {
+		return 0, ErrClosed
+	}
+	return len(b), nil
+}
+
+// Sync writes the queued messages and syncs all the sinks, it fails for the
+// sinks stalled or not synced within SinkTimeout
+func (t *TeeWriter) Sync() error {
+	done := make(chan error, 1)
+	select {
+	case t.syncCh <- done:
+	case <-t.stopped:
+		return ErrClosed
+	}
+	return <-done
+}
+
+// Close writes the queued messages and closes all the sinks
+func (t *TeeWriter) Close() error {
+	t.closeOnce.Do(func() {
+		t.queue.close()
+		<-t.stopped
+	})
+	return nil
+}
+
+// Stats returns the stats of the file sinks
+func (t *TeeWriter) Stats() []Stats {
+	stats := make([]Stats, 0, len(t.files))
+	for _, w := range t.files {
+		stats = append(stats, w.Stats())
+	}
+	return stats
+}
+
+// Dropped returns the number of messages dropped for each sink, in the
+// order of the sinks
+func (t *TeeWriter) Dropped() []uint64 {
+	dropped := make([]uint64, 0, len(t.sinks))
+	for _, s := range t.sinks {
+		dropped = append(dropped, s.dropped.Load())
+	}
+	return dropped
+}
+
+// isolate runs a sink operation, a panic in the sink is logged instead of
+// stopping the other sinks
+func isolate(op string, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Println("Sink", op, "error", r)
+		}
+	}()
+	fn()
+}
@@ -0,0 +1,182 @@
+package rollingwriter
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write(b []byte) (int, error) {
+	return 0, errors.New("failing sink")
+}
+
+// hungWriter blocks every write until gate is closed
+type hungWriter struct {
+	gate chan struct{}
+}
+
+func (h hungWriter) Write(b []byte) (int, error) {
+	<-h.gate
+	return len(b), nil
+}
+
+type panicWriter struct{}
+
+func (panicWriter) Write(b []byte) (int, error) {
+	panic("panicking sink")
+}
+
+func TestTeeWriter(t *testing.T) {
+	local := NewDefaultConfig()
+	local.FilePath = "./test/tee/local.log"
+	remote := NewDefaultConfig()
+	remote.FilePath = "./test/tee/remote.log"
+	var out bytes.Buffer
+
+	w, err := NewTeeWriter(FileSink(&local), FileSink(&remote),
+		WriterSink(failingWriter{}), WriterSink(panicWriter{}), WriterSink(&out))
+	assert.Nil(t, err)
+	w.Write([]byte("hello\n"))
+	w.Write([]byte("world\n"))
+	assert.Nil(t, w.Close())
+	assert.Nil(t, w.Close())
+	_, err = w.Write([]byte("closed\n"))
+	assert.Equal(t, ErrClosed, err)
+
+	for _, path := range []string{local.FilePath, remote.FilePath} {
+		b, _ := os.ReadFile(path)
+		assert.Equal(t, "hello\nworld\n", string(b))
+	}
+	assert.Equal(t, "hello\nworld\n", out.String())
+	for _, s := range w.(*TeeWriter).Stats() {
+		assert.Equal(t, uint64(2), s.Records)
+		assert.Equal(t, uint64(12), s.BytesWritten)
+	}
+
+	_, err = NewTeeWriter(Sink{})
+	assert.Equal(t, ErrInvalidArgument, err)
+	os.RemoveAll("./test/tee")
+	clean()
+}
+
+func TestTeeSync(t *testing.T) {
+	local := NewDefaultConfig()
+	local.FilePath = "./test/tee/local.log"
+	var out bytes.Buffer
+
+	// the messages are in the sinks once Sync returns
+	w, err := NewTeeWriter(FileSink(&local), WriterSink(&out))
+	assert.Nil(t, err)
+	tee := w.(*TeeWriter)
+	w.Write([]byte("hello\n"))
+	assert.Nil(t, tee.Sync())
+	b, _ := os.ReadFile(local.FilePath)
+	assert.Equal(t, "hello\n", string(b))
+	assert.Equal(t, "hello\n", out.String())
+	assert.Nil(t, w.Close())
+	assert.Equal(t, ErrClosed, tee.Sync())
+	os.RemoveAll("./test/tee")
+	clean()
+}
+
+func TestTeeBackpressure(t *testing.T) {
+	local := NewDefaultConfig()
+	local.FilePath = "./test/tee/local.log"
+	local.QueueSize = MinQueueSize
+
+	// the writes wait for a healthy sink instead of dropping the messages
+	w, err := NewTeeWriter(FileSink(&local))
+	assert.Nil(t, err)
+	const records = 20000
+	for range records {
+		_, err = w.Write([]byte("hello\n"))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, w.Close())
+	b, _ := os.ReadFile(local.FilePath)
+	assert.Equal(t, records*6, len(b))
+	assert.Equal(t, []uint64{0}, w.(*TeeWriter).Dropped())
+	os.RemoveAll("./test/tee")
+	clean()
+}
+
+func TestTeeHungSink(t *testing.T) {
+	defer func(timeout time.Duration) { SinkTimeout = timeout }(SinkTimeout)
+	SinkTimeout = 50 * time.Millisecond
+	local := NewDefaultConfig()
+	local.FilePath = "./test/tee/local.log"
+	local.QueueSize = MinQueueSize
+	hung := hungWriter{make(chan struct{})}
+
+	w, err := NewTeeWriter(FileSink(&local), WriterSink(hung))
+	assert.Nil(t, err)
+	tee := w.(*TeeWriter)
+
+	// the file sink is written while the writer sink hangs
+	const records = 4 * MinQueueSize
+	done := make(chan struct{})
+	go func() {
+		for range records {
+			w.Write([]byte("hello\n"))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("write blocked on the hung sink")
+	}
+	// the queued messages are dispatched by the sync
+	assert.True(t, errors.Is(tee.Sync(), ErrSinkStalled))
+	dropped := tee.Dropped()
+	assert.Equal(t, uint64(0), dropped[0])
+	assert.True(t, dropped[1] > 0)
+
+	// the sink catches up once it is released
+	close(hung.gate)
+	assert.Eventually(t, func() bool { return tee.healthy.Load() == 2 }, time.Second, 10*time.Millisecond)
+	w.Write([]byte("hello\n"))
+	assert.Nil(t, tee.Sync())
+	assert.Equal(t, dropped[1], tee.Dropped()[1])
+
+	assert.Nil(t, w.Close())
+	b, _ := os.ReadFile(local.FilePath)
+	assert.Equal(t, (records+1)*6, len(b))
+	assert.Equal(t, uint64(records+1), tee.Stats()[0].RecordsWritten)
+	os.RemoveAll("./test/tee")
+	clean()
+}
+
+func TestTeeStalled(t *testing.T) {
+	defer func(timeout time.Duration) { SinkTimeout = timeout }(SinkTimeout)
+	SinkTimeout = 50 * time.Millisecond
+	hung := hungWriter{make(chan struct{})}
+	w, err := NewTeeWriter(WriterSink(hung))
+	assert.Nil(t, err)
+
+	// the writes fail once the message reach no sink
+	_, err = w.Write([]byte("first\n"))
+	assert.Nil(t, err)
+	w.Write([]byte("second\n"))
+	assert.Eventually(t, func() bool {
+		_, err = w.Write([]byte("lost\n"))
+		return errors.Is(err, ErrSinkStalled)
+	}, time.Second, 10*time.Millisecond)
+	assert.True(t, w.(*TeeWriter).Dropped()[0] > 0)
+	assert.True(t, errors.Is(w.(*TeeWriter).Sync(), ErrSinkStalled))
+
+	close(hung.gate)
+	assert.Eventually(t, func() bool {
+		_, err = w.Write([]byte("again\n"))
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	assert.Nil(t, w.Close())
+	_, err = w.Write([]byte("closed\n"))
+	assert.Equal(t, ErrClosed, err)
+}
@@ -4,36 +4,337 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // Writer provide a synchronous file writer
 // if Lock is set true, write will be guaranteed by lock
 type Writer struct {
-	monitor          FileMonitor
-	file             *os.File
-	absPath          string
-	fire             chan string
-	conf             *Config
-	rotationEventsCh chan string
-	writeCh          chan []byte
-	errorCh          chan error
-	ctx              context.Context
-	cancel           context.CancelFunc
+	monitor     FileMonitor
+	file        File
+	fs          FileSystem
+	absPath     string
+	buffer      []byte
+	scratch     []byte
+	conf        *Config
+	clock       Clock
+	startAt     time.Time
+	firstWrite  time.Time
+	lastWrite   time.Time
+	maxAge      time.Duration
+	idle        time.Duration
+	records     int
+	pending     [][]byte
+	copied      int
+	copyStart   int
+	iovecs      []iovec
+	pendingSize int
+	buffered    uint64
+	written     [][]byte
+	recycled    chan []byte
+	writeErr    error
+	events      eventHub
+	queue       *queue
+	cur         *batch
+	spare       chan *batch
+	ioCh        chan ioRequest
+	held        atomic.Int64
+	errorCh     chan error
+	stopped     chan struct{}
+	syncCh      chan chan error
+	rotateCh    chan rotateRequest
+	ctx         context.Context
+	cancel      context.CancelFunc
+	compressor  *compressPool
+	stats       writerStats
+	closeOnce   sync.Once
 }
 
+// maxIovecs is the most messages written at once, the IOV_MAX of writev
+const maxIovecs = 1024
+
+// maxCopySize is the largest message copied into the buffer, a writev of
+// many small buffers is slower than copying them
+const maxCopySize = 1024
+
+// maxRecycledSize is the largest message buffer recycled by the writer
+const maxRecycledSize = 64 << 10
+
+// owned marks the queued messages whose buffer the writer owns, in place of
+// an acknowledgement channel. Their buffers are recycled once written
+var owned = make(chan error)
+
+// batch is a run of queued messages the collector go routine hands to the
+// I/O go routine
+type batch struct {
+	msgs [][]byte
+	size int
+	// acks are the messages of the synchronous writes, in order
+	acks []ack
+	// owned are the buffers to recycle once written
+	owned [][]byte
+}
+
+// ack is the acknowledgement of the message at index of the batch
+type ack struct {
+	index int
+	done  chan error
+}
+
+// ioRequest is the next job of the I/O go routine: a batch of messages, or
+// a Sync, Rotate or Close call which applies after the batches sent before
+type ioRequest struct {
+	batch  *batch
+	sync   chan error
+	rotate *rotateRequest
+	stop   chan struct{}
+}
+
+// startFileWriterLoop opens the file and starts the writer go routines.
+// The collector go routine drains the queue into a batch while the I/O go
+// routine writes the previous one, so that the queue is still drained while
+// the file is written or rotated. The I/O go routine owns the file
 func (w *Writer) startFileWriterLoop() error {
+	if err := w.startIOLoop(); err != nil {
+		return err
+	}
+
+	w.cur = &batch{}
+	go func() {
+		for {
+			// the batch is handed over once the I/O go routine is done
+			// with the previous one
+			w.queue.drain(w.collect)
+			var handOff chan ioRequest
+			if len(w.cur.msgs) > 0 {
+				handOff = w.ioCh
+			}
+			select {
+			case <-w.queue.wait():
+			case handOff <- ioRequest{batch: w.cur}:
+				w.cur = <-w.spare
+			case req := <-w.rotateCh:
+				// the messages queued before Rotate was called go to the
+				// rotated file
+				w.handOff()
+				w.ioCh <- ioRequest{rotate: &req}
+			case done := <-w.syncCh:
+				// the messages queued before Sync was called are written too
+				w.handOff()
+				w.ioCh <- ioRequest{sync: done}
+			case <-w.errorCh:
+				// Stopping write, the messages still queued are written first
+				w.handOff()
+				stopped := make(chan struct{})
+				w.ioCh <- ioRequest{stop: stopped}
+				<-stopped
+				close(w.stopped)
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// startIOLoop opens the file and starts the I/O go routine, which takes
+// the batches on ioCh and gives them back on spare once written
+func (w *Writer) startIOLoop() error {
+	if err := w.openFile(); err != nil {
+		return err
+	}
+
+	w.spare <- &batch{}
+	go w.ioLoop(w.clock.NewTicker(time.Duration(MaxWriteInterval) * time.Second))
+	return nil
+}
+
+// collect adds the message to the current batch, the batch is handed to
+// the I/O go routine once full
+func (w *Writer) collect(data []byte, done chan error) {
+	if done == owned {
+		w.cur.owned = append(w.cur.owned, data)
+	} else if done != nil {
+		w.cur.acks = append(w.cur.acks, ack{index: len(w.cur.msgs), done: done})
+	}
+	w.cur.msgs = append(w.cur.msgs, data)
+	w.cur.size += len(data)
+	w.held.Add(1)
+	if w.cur.size >= w.conf.BufferSize || len(w.cur.msgs) >= w.queue.cap() {
+		w.send()
+	}
+}
+
+// handOff drains the queue and passes the current batch to the I/O go
+// routine
+func (w *Writer) handOff() {
+	w.queue.drain(w.collect)
+	if len(w.cur.msgs) > 0 {
+		w.send()
+	}
+}
+
+// send passes the current batch to the I/O go routine, waiting for it to
+// finish the previous batch
+func (w *Writer) send() {
+	w.ioCh <- ioRequest{batch: w.cur}
+	w.cur = <-w.spare
+}
+
+// ioLoop writes the batches and rotates the file in the order of the
+// requests, the batch is given back to the collector once written
+func (w *Writer) ioLoop(ticker Ticker) {
+	defer ticker.Stop()
+	for {
+		select {
+		case req := <-w.ioCh:
+			switch {
+			case req.batch != nil:
+				w.writeBatch(req.batch)
+				w.spare <- req.batch
+			case req.rotate != nil:
+				backupPath, err := w.rotate(RotationTrigger{Reason: RotationManual, At: req.rotate.at})
+				req.rotate.done <- rotateResult{backupPath: backupPath, err: err}
+			case req.sync != nil:
+				// the writes failed since the last sync or commit fail it
+				w.flush()
+				err := w.writeErr
+				w.writeErr = nil
+				if err == nil {
+					if err = w.file.Sync(); err != nil {
+						w.stats.failed(phaseSync)
+					}
+				}
+				req.sync <- err
+			case req.stop != nil:
+				w.closeFile()
+				w.events.close()
+				close(req.stop)
+				return
+			}
+		case t := <-w.monitor.Triggers():
+			w.rotate(t)
+		case now := <-ticker.C():
+			w.tick(now)
+		}
+	}
+}
+
+// writeBatch processes the messages of the batch, a synchronous write is
+// committed before it is acknowledged. Under GroupCommit the whole batch is
+// committed at once. The batch is emptied for reuse
+func (w *Writer) writeBatch(b *batch) {
+	if w.conf.GroupCommit {
+		for _, data := range b.msgs {
+			w.process(data)
+		}
+		if len(b.acks) > 0 {
+			err := w.commit(len(b.acks))
+			for _, a := range b.acks {
+				a.done <- err
+			}
+		}
+	} else {
+		acks := b.acks
+		for i, data := range b.msgs {
+			w.process(data)
+			if len(acks) > 0 && acks[0].index == i {
+				acks[0].done <- w.commit(1)
+				acks = acks[1:]
+			}
+		}
+	}
+	w.held.Add(-int64(len(b.msgs)))
+
+	// the buffers may still be gathered for the next flush
+	w.written = append(w.written, b.owned...)
+	if len(w.pending) == 0 {
+		w.recycle()
+	}
+
+	clear(b.msgs)
+	clear(b.acks)
+	clear(b.owned)
+	b.msgs, b.acks, b.owned = b.msgs[:0], b.acks[:0], b.owned[:0]
+	b.size = 0
+}
+
+// recycle gives back the buffers of the written messages for the next
+// owned writes
+func (w *Writer) recycle() {
+	for _, buf := range w.written {
+		if cap(buf) > maxRecycledSize {
+			continue
+		}
+		select {
+		case w.recycled <- buf:
+		default:
+		}
+	}
+	clear(w.written)
+	w.written = w.written[:0]
+}
+
+// ownedBuffer returns a buffer of n bytes for writeOwned, recycled from the
+// written messages if one is large enough
+func (w *Writer) ownedBuffer(n int) []byte {
+	select {
+	case buf := <-w.recycled:
+		if cap(buf) >= n {
+			return buf[:n]
+		}
+	default:
+	}
+	// round up so that the buffer fits the following messages too
+	size := 256
+	for size < n {
+		size <<= 1
+	}
+	return make([]byte, n, size)
+}
+
+// writeOwned enqueues a message whose buffer was given by ownedBuffer, the
+// writer recycles the buffer once the message is written. It returns
+// ErrClosed once the writer is closed
+func (w *Writer) writeOwned(b []byte) (int, error) {
+	if !w.queue.push(b, owned) {
+		return 0, ErrClosed
+	}
+	return len(b), nil
+}
+
+// commit writes the buffered messages and syncs the file if Fsync is set,
+// acknowledging the given number of records. It returns the first write or
+// sync error since the last commit
+func (w *Writer) commit(records int) error {
+	start := time.Now()
+	defer func() { w.stats.committedBatch(records, time.Since(start)) }()
+	w.flush()
+	err := w.writeErr
+	w.writeErr = nil
+	if err == nil && w.conf.Fsync {
+		if err = w.file.Sync(); err != nil {
+			w.stats.failed(phaseSync)
+		}
+	}
+	return err
+}
+
+// openFile creates the directories and opens the log file for append
+func (w *Writer) openFile() error {
 	var err error
 	c := w.conf
 
 	// make dir for path if not exist
-	if err = os.MkdirAll(filepath.Dir(c.FilePath), c.DirMode); err != nil {
+	if err = w.fs.MkdirAll(filepath.Dir(c.FilePath), c.DirMode); err != nil {
 		return fmt.Errorf("failed to create directories for %s: %w", c.FilePath, err)
 	}
 
@@ -42,147 +343,419 @@ func (w *Writer) startFileWriterLoop() error {
 	}
 
 	// open the file and get the FD
-	file, err := os.OpenFile(w.absPath, DefaultFileFlag, c.FileMode)
+	file, err := w.fs.OpenFile(w.absPath, DefaultFileFlag, c.FileMode)
 	if err != nil {
 		return fmt.Errorf("failed to open file - %s: %w", w.absPath, err)
 	}
 
 	w.file = file
+	w.startAt = w.clock.Now()
+	w.lastWrite = w.startAt
+	w.buffer = make([]byte, 0, c.BufferSize)
+	w.copied = -1
 
-	logbuffer := make([]byte, 0, c.BufferSize)
-	bbuffer := bytes.NewBuffer(logbuffer)
-	ticker := time.NewTicker(time.Duration(MaxWriteInterval) * time.Second)
-
-	directWriteMsgSize := c.BufferSize / 4
-
-	go func() {
-		for {
-			select {
-			case data := <-w.writeCh:
-				// First, try to add the data to buffer
-				if len(data)+bbuffer.Len() < c.BufferSize {
-					bbuffer.Write(data)
-				} else {
-					n, err := bbuffer.WriteTo(w.file)
-					if err != nil {
-						log.Println("File write", n, err)
-					}
-					bbuffer.Reset()
-					// if the new message is big, write to file directly
-					if len(data) > directWriteMsgSize {
-						n, err := w.file.Write(data)
-						if err != nil {
-							log.Println("File write", n, err)
-						}
-					} else {
-						bbuffer.Write(data)
-					}
-				}
-			case filename := <-w.fire:
-				if err := w.RotateFile(filename); err != nil {
-					log.Println("File rolling error", err)
-				}
-			case <-ticker.C:
-				if bbuffer.Len() > 0 {
-					n, err := bbuffer.WriteTo(w.file)
-					if err != nil {
-						log.Println("File write", n, err)
-					}
-					bbuffer.Reset()
-				}
-			case <-w.errorCh:
-				// Stopping write
-				if bbuffer.Len() > 0 {
-					n, err := bbuffer.WriteTo(w.file)
-					if err != nil {
-						log.Println("File write", n, err)
-					}
-				}
-				w.file.Close()
-				w.errorCh <- nil
-				return
-			}
+	// the records already in the file count against RollingRecords
+	if c.RollingPolicy == RecordRolling {
+		if w.records, err = countRecords(file); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to read file - %s: %w", w.absPath, err)
 		}
-	}()
+	}
+
+	w.catchUp()
 	return nil
 }
 
-/*
-	// TODO: make this into a function
-	if c.MaxRemain > 0 {
-		w.rollingFileCh = make(chan string, c.MaxRemain)
-		dir, err := os.ReadDir(c.LogPath)
+// catchUp rotates the file found at startup if the rolling policy would
+// have rotated it while the writer was not running
+func (w *Writer) catchUp() {
+	info, err := w.file.Stat()
+	if err != nil || info.Size() == 0 {
+		return
+	}
+
+	now := w.clock.Now()
+	trigger := RotationTrigger{At: now}
+	switch w.conf.RollingPolicy {
+	case TimeRolling:
+		// a rotation was due since the file was last written
+		spec, err := timeSchedule(w.conf)
 		if err != nil {
-			w.errorCh <- err
 			return
 		}
+		next := inLocation(spec, w.conf.location()).Next(info.ModTime())
+		if next.IsZero() || next.After(now) {
+			return
+		}
+		trigger.Reason = RotationTime
+	case VolumeRolling:
+		if info.Size() <= volumeThreshold(w.conf) {
+			return
+		}
+		trigger.Reason = RotationSize
+	case RecordRolling:
+		if w.conf.RollingRecords <= 0 || w.records < w.conf.RollingRecords {
+			return
+		}
+		trigger.Reason = RotationRecords
+	default:
+		return
+	}
 
-		files := make([]string, 0, 10)
-		for _, fi := range dir {
-			if fi.IsDir() {
-				continue
-			}
+	// the backup is tagged with the time the file was last written
+	w.startAt = info.ModTime()
+	w.rotate(trigger)
+}
 
-			fileName := c.FileName + "." + c.FileExtension + "."
-			if strings.Contains(fi.Name(), fileName) {
-				fileSuffix := path.Ext(fi.Name())
-				if len(fileSuffix) > 1 {
-					_, err := time.Parse(c.TimeTagFormat, fileSuffix[1:])
-					if err == nil {
-						files = append(files, fi.Name())
-					}
-				}
-			}
+// process writes the message, under RecordRolling the file is rotated
+// right after the last record it may hold
+func (w *Writer) process(data []byte) {
+	w.stats.recordsWritten.Add(1)
+	if w.conf.RollingPolicy != RecordRolling {
+		w.bufferWrite(data)
+		return
+	}
+
+	for len(data) > 0 {
+		// the file may be over the limit after a failed rotation, the next
+		// record rotates it then
+		i := indexRecordEnd(data, max(1, w.conf.RollingRecords-w.records))
+		if i < 0 {
+			w.records += bytes.Count(data, []byte{'\n'})
+			w.bufferWrite(data)
+			return
 		}
-		sort.Slice(files, func(i, j int) bool {
-			fileSuffix1 := path.Ext(files[i])
-			fileSuffix2 := path.Ext(files[j])
-			t1, _ := time.Parse(c.TimeTagFormat, fileSuffix1[1:])
-			t2, _ := time.Parse(c.TimeTagFormat, fileSuffix2[1:])
-			return t1.Before(t2)
-		})
+		w.bufferWrite(data[:i+1])
+		w.rotate(RotationTrigger{Reason: RotationRecords, At: w.clock.Now()})
+		// a failed rotation is retried after another full file
+		w.records = 0
+		data = data[i+1:]
+	}
+}
 
-		for _, file := range files {
-		retry:
-			select {
-			case w.rollingFileCh <- path.Join(c.LogPath, file):
-			default:
-				w.DoRemove()
-				goto retry // remove the file and retry
-			}
+// countRecords returns the number of newlines in the file
+func countRecords(file File) (int, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	records := 0
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := file.Read(buf)
+		records += bytes.Count(buf[:n], []byte{'\n'})
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return 0, err
 		}
 	}
-*/
+}
+
+// indexRecordEnd returns the index of the n-th newline in data, or -1
+func indexRecordEnd(data []byte, n int) int {
+	end := -1
+	for ; n > 0; n-- {
+		i := bytes.IndexByte(data[end+1:], '\n')
+		if i < 0 {
+			return -1
+		}
+		end += i + 1
+	}
+	return end
+}
+
+// bufferWrite adds the message to the buffer, the buffer is written to
+// the file first if the message does not fit in
+func (w *Writer) bufferWrite(data []byte) {
+	if w.idle > 0 || w.conf.BackupTimeTag != "" {
+		w.lastWrite = w.clock.Now()
+		if w.firstWrite.IsZero() {
+			w.firstWrite = w.lastWrite
+		}
+	}
+	if w.conf.RotationPolicy != nil {
+		w.conf.RotationPolicy.Written(len(data))
+	}
+
+	// the small messages are copied into the buffer, the others are
+	// gathered without copying them, and they are written together once
+	// they fill the buffer size
+	if len(data) <= maxCopySize && len(w.buffer)+len(data) <= cap(w.buffer) {
+		start := len(w.buffer)
+		w.buffer = append(w.buffer, data...)
+		if last := len(w.pending) - 1; last >= 0 && w.copied == last {
+			// extend the buffer segment
+			w.pending[last] = w.buffer[w.copyStart:]
+		} else {
+			w.copied, w.copyStart = len(w.pending), start
+			w.pending = append(w.pending, w.buffer[start:])
+		}
+	} else {
+		w.pending = append(w.pending, data)
+	}
+	w.pendingSize += len(data)
+	w.buffered++
+
+	// if the new message is big, write it out at once
+	if len(data) > w.conf.BufferSize/4 {
+		w.stats.directWrites.Add(1)
+		w.flush()
+		return
+	}
+	if w.pendingSize >= w.conf.BufferSize || len(w.pending) >= maxIovecs {
+		w.flush()
+	}
+}
+
+// flush writes the gathered messages to the file in one vectored write
+func (w *Writer) flush() {
+	if len(w.pending) == 0 {
+		return
+	}
+	n, err := w.writeBuffers(w.pending)
+	w.stats.flushes.Add(1)
+	w.stats.written(n, err)
+	if err != nil {
+		// the records are lost with the batch
+		w.stats.dropped.Add(w.buffered)
+		log.Println("File write", n, err)
+		if w.writeErr == nil {
+			w.writeErr = err
+		}
+	}
+	clear(w.pending)
+	w.pending = w.pending[:0]
+	w.pendingSize = 0
+	w.buffer = w.buffer[:0]
+	w.copied = -1
+	w.buffered = 0
+	w.recycle()
+}
+
+// writeCopy writes the buffers to the file with a single Write, through
+// a scratch buffer. It is used where vectored writes are not available
+func (w *Writer) writeCopy(bufs [][]byte) (int64, error) {
+	if len(bufs) == 1 {
+		n, err := w.file.Write(bufs[0])
+		return int64(n), err
+	}
+	w.scratch = w.scratch[:0]
+	for _, b := range bufs {
+		w.scratch = append(w.scratch, b...)
+	}
+	n, err := w.file.Write(w.scratch)
+	if cap(w.scratch) > 2*w.conf.BufferSize {
+		// do not keep the room taken by a big message
+		w.scratch = nil
+	}
+	return int64(n), err
+}
+
+// consumeBuffers drops the first n written bytes from the buffers
+func consumeBuffers(bufs [][]byte, n int) [][]byte {
+	for len(bufs) > 0 && n >= len(bufs[0]) {
+		n -= len(bufs[0])
+		bufs = bufs[1:]
+	}
+	if len(bufs) > 0 {
+		bufs[0] = bufs[0][n:]
+	}
+	return bufs
+}
+
+// tick flushes the buffer and rotates the file if it is too old or idle
+func (w *Writer) tick(now time.Time) {
+	w.flush()
+	switch {
+	case w.maxAge > 0 && now.Sub(w.startAt) >= w.maxAge:
+		w.rotate(RotationTrigger{Reason: RotationAge, At: now})
+	case w.idle > 0 && now.Sub(w.lastWrite) >= w.idle:
+		w.rotate(RotationTrigger{Reason: RotationIdle, At: now})
+	}
+}
+
+// rotate flushes the buffer into the current file and rotates it to the
+// backup file named after the time the file was started. It returns the
+// backup file, which is empty if the rotation was skipped
+func (w *Writer) rotate(t RotationTrigger) (string, error) {
+	w.flush()
+
+	event := RotationEvent{
+		Reason:      t.Reason,
+		BackupPath:  uniqueFileName(w.fs, w.backupFileName()),
+		StartTime:   w.startAt,
+		TriggeredAt: t.At,
+	}
+	if info, err := w.file.Stat(); err == nil {
+		event.Bytes = info.Size()
+	}
+
+	// age and idle rotations never backup empty files, the age of an
+	// empty file starts over
+	if event.Bytes == 0 && (t.Reason == RotationAge || t.Reason == RotationIdle) {
+		if t.Reason == RotationAge {
+			w.startAt = t.At
+		}
+		return "", nil
+	}
+
+	rotated, err := w.rotateFile(event.BackupPath)
+	if err != nil {
+		w.stats.failed(phaseRotate)
+		log.Println("File rolling error", err)
+		return "", err
+	}
+	if !rotated {
+		return "", nil
+	}
+	event.EndTime = w.startAt
+	w.stats.rotated(t.Reason, t.At, w.clock.Now())
+	w.records = 0
+	w.events.publish(event)
+	if w.conf.RotationPolicy != nil {
+		w.conf.RotationPolicy.Rotated(event)
+	}
+	return event.BackupPath, nil
+}
+
+// rotateRequest is a Rotate call waiting on the writer go routine
+type rotateRequest struct {
+	at   time.Time
+	done chan rotateResult
+}
+
+type rotateResult struct {
+	backupPath string
+	err        error
+}
+
+// Rotate asks the writer go routine to write the queued messages and
+// rotate the file, it returns the backup file once the file is renamed.
+// The backup file is empty if the rotation was skipped by
+// FilterEmptyBackup. The rotation still completes if ctx is done first
+func (w *Writer) Rotate(ctx context.Context) (backupPath string, err error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	req := rotateRequest{at: w.clock.Now(), done: make(chan rotateResult, 1)}
+	select {
+	case w.rotateCh <- req:
+	case <-w.ctx.Done():
+		return "", ErrClosed
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+
+	select {
+	case res := <-req.done:
+		return res.backupPath, res.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// backupFileName returns the backup file name of the current file, tagged
+// as set by BackupTimeTag
+func (w *Writer) backupFileName() string {
+	if w.firstWrite.IsZero() {
+		return backupFileName(w.conf, w.startAt)
+	}
+	switch w.conf.BackupTimeTag {
+	case TagFirstWrite:
+		return backupPath(w.conf, formatTimeTag(w.conf, w.firstWrite))
+	case TagWriteRange:
+		return backupPath(w.conf, formatTimeTag(w.conf, w.firstWrite)+"-"+formatTimeTag(w.conf, w.lastWrite))
+	}
+	return backupFileName(w.conf, w.startAt)
+}
+
+// uniqueFileName appends a counter to the file name if the file exists, so
+// that rotations within one time tag do not overwrite each other
+func uniqueFileName(fs FileSystem, name string) string {
+	unique := name
+	for i := 1; ; i++ {
+		if _, err := fs.Stat(unique); os.IsNotExist(err) {
+			return unique
+		}
+		unique = name + "." + strconv.Itoa(i)
+	}
+}
+
+// closeFile flushes the buffer and closes the file
+func (w *Writer) closeFile() {
+	w.flush()
+	w.file.Close()
+}
 
 // NewWriterFromConfig generate the rollingWriter with given config
 func NewWriterFromConfig(c *Config) (RollingWriter, error) {
+	writer, err := createWriter(c, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = writer.startFileWriterLoop(); err != nil {
+		writer.monitor.Close()
+		return nil, err
+	}
+	return writer, nil
+}
+
+// createWriter generate the Writer with given config, using the shared
+// scheduler and compression pool when they are not nil. The file writer
+// loop is not started yet
+func createWriter(c *Config, sched *scheduler, pool *compressPool) (*Writer, error) {
 	// Set defaults
 	sanitizeConfig(c)
 
+	var err error
+	var maxAge, idle time.Duration
+	if c.MaxAge != "" {
+		if maxAge, err = time.ParseDuration(c.MaxAge); err != nil {
+			return nil, fmt.Errorf("%w: max age %s", ErrInvalidArgument, c.MaxAge)
+		}
+	}
+	if c.IdleTimeout != "" {
+		if idle, err = time.ParseDuration(c.IdleTimeout); err != nil {
+			return nil, fmt.Errorf("%w: idle timeout %s", ErrInvalidArgument, c.IdleTimeout)
+		}
+	}
+	if c.RollingPolicy == RecordRolling && c.RollingRecords <= 0 {
+		return nil, fmt.Errorf("%w: rolling records %d", ErrInvalidArgument, c.RollingRecords)
+	}
+	if c.Location == nil && c.TimeZone != "" {
+		if c.Location, err = time.LoadLocation(c.TimeZone); err != nil {
+			return nil, fmt.Errorf("%w: time zone %s", ErrInvalidArgument, c.TimeZone)
+		}
+	}
+
 	// Start the Manager
-	mng, err := NewManager(c)
+	mng, err := newManager(c, sched)
 	if err != nil {
 		return nil, err
 	}
 
-	var rollingWriter RollingWriter
-	writer := Writer{
-		monitor:          mng,
-		rotationEventsCh: mng.RotationEvents(),
-		conf:             c,
-		writeCh:          make(chan []byte, c.QueueSize),
-		errorCh:          make(chan error),
+	writer := &Writer{
+		monitor:    mng,
+		maxAge:     maxAge,
+		idle:       idle,
+		conf:       c,
+		clock:      c.clock(),
+		fs:         c.fs(),
+		queue:      newQueue(c.QueueSize),
+		spare:      make(chan *batch, 1),
+		ioCh:       make(chan ioRequest),
+		errorCh:    make(chan error),
+		stopped:    make(chan struct{}),
+		syncCh:     make(chan chan error),
+		rotateCh:   make(chan rotateRequest),
+		recycled:   make(chan []byte, c.QueueSize),
+		compressor: pool,
 	}
-
 	writer.ctx, writer.cancel = context.WithCancel(context.Background())
-	err = writer.startFileWriterLoop()
-	if err != nil {
-		mng.Close()
-		log.Println("Some error", err)
-		os.Exit(1)
-	}
-	rollingWriter = &writer
-	return rollingWriter, nil
+	return writer, nil
 }
 
 // NewWriter generate the rollingWriter with given option
@@ -195,6 +768,10 @@ func NewWriter(ops ...Option) (RollingWriter, error) {
 }
 
 func sanitizeConfig(c *Config) {
+	if c.GroupCommit {
+		c.Synchronous, c.Fsync = true, true
+	}
+
 	if c.QueueSize < MinQueueSize {
 		c.QueueSize = MinQueueSize
 	}
@@ -212,96 +789,245 @@ func sanitizeConfig(c *Config) {
 	}
 }
 
-// CompressFile compress log file write into .gz
-func CompressFile(oldfile *os.File, cmpname string, fileMode os.FileMode) error {
-	cmpfile, err := os.OpenFile(cmpname, DefaultFileFlag, fileMode)
+// CompressFile compress log file write into .gz, cmpname must not exist
+func CompressFile(oldfile io.ReadSeeker, cmpname string, fileMode os.FileMode) error {
+	return compressFile(osFS{}, oldfile, cmpname, fileMode)
+}
+
+// compressFile writes the gzip compressed content of oldfile to cmpname on
+// the file system, cmpname is removed if the compression fails
+func compressFile(fs FileSystem, oldfile io.ReadSeeker, cmpname string, fileMode os.FileMode) error {
+	cmpfile, err := fs.OpenFile(cmpname, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fileMode)
 	if err != nil {
 		return err
 	}
-	defer cmpfile.Close()
 	gw := gzip.NewWriter(cmpfile)
-	defer gw.Close()
 
-	if _, err = oldfile.Seek(0, 0); err != nil {
-		return err
+	if _, err = oldfile.Seek(0, 0); err == nil {
+		_, err = io.Copy(gw, oldfile)
 	}
-
-	if _, err = io.Copy(gw, oldfile); err != nil {
-		if errR := os.Remove(cmpname); errR != nil {
-			return errR
+	// the compressed data is only complete once both are closed, and it
+	// is synced before the original is removed
+	if errC := gw.Close(); err == nil {
+		err = errC
+	}
+	if err == nil {
+		err = cmpfile.Sync()
+	}
+	err = errors.Join(err, cmpfile.Close())
+	if err != nil {
+		if errR := fs.Remove(cmpname); errR != nil {
+			return errors.Join(err, errR)
 		}
 		return err
 	}
 	return nil
 }
 
-// RotateFile do the rotate, open new file and swap FD then trate the old FD
+// RotateFile do the rotate, open new file and swap FD then trate the old FD.
+// It must not be called while the writer go routine is running, use
+// Rotate instead
 func (w *Writer) RotateFile(newBackUpFile string) error {
+	rotated, err := w.rotateFile(newBackUpFile)
+	if rotated {
+		now := w.clock.Now()
+		w.stats.rotated(RotationManual, now, now)
+	}
+	return err
+}
+
+// rotateFile do the rotate, it reports whether the file was rotated or
+// skipped as an empty backup
+func (w *Writer) rotateFile(newBackUpFile string) (bool, error) {
 	if w.conf.FilterEmptyBackup {
 		fileInfo, err := w.file.Stat()
 		if err != nil {
-			return err
+			return false, err
 		}
 
 		if fileInfo.Size() == 0 {
-			return nil
+			return false, nil
 		}
 	}
 
+	// the acknowledged writes must survive in the backup
+	if w.conf.Fsync {
+		if err := w.file.Sync(); err != nil {
+			w.stats.failed(phaseSync)
+			log.Println("error in sync file", err)
+		}
+	}
 	w.file.Close()
-	if err := os.Rename(w.absPath, newBackUpFile); err != nil {
-		return err
+	if err := w.fs.Rename(w.absPath, newBackUpFile); err != nil {
+		// keep writing to the current file
+		w.reopen(w.absPath)
+		return false, err
 	}
-	newfile, err := os.OpenFile(w.absPath, DefaultFileFlag, w.conf.FileMode)
+	newfile, err := w.fs.OpenFile(w.absPath, DefaultFileFlag, w.conf.FileMode)
 	if err != nil {
-		return err
+		// move the file back and keep writing to it
+		if errR := w.fs.Rename(newBackUpFile, w.absPath); errR != nil {
+			w.reopen(newBackUpFile)
+			return false, errors.Join(err, errR)
+		}
+		w.reopen(w.absPath)
+		return false, err
 	}
 
 	w.file = newfile
+	w.startAt = w.clock.Now()
+	w.firstWrite = time.Time{}
 
-	go func() {
-		if w.conf.Compress {
-			if err := os.Rename(newBackUpFile, newBackUpFile+".tmp"); err != nil {
-				log.Println("error in compress rename tempfile", err)
-				return
-			}
-			tmpBackupFile, err := os.OpenFile(newBackUpFile+".tmp", DefaultFileFlag, w.conf.FileMode)
-			if err != nil {
-				log.Println("error in open tempfile", err)
-				return
-			}
-			var closeOnce sync.Once
-			defer closeOnce.Do(func() { tmpBackupFile.Close() })
-			if err := CompressFile(tmpBackupFile, newBackUpFile, w.conf.FileMode); err != nil {
-				log.Println("error in compress log file", err)
-				return
+	if w.conf.Compress || w.conf.MaxBackups > 0 {
+		c := w.conf
+		job := func() {
+			if c.Compress {
+				start := time.Now()
+				if err := compressBackup(c.fs(), newBackUpFile, c.FileMode); err != nil {
+					w.stats.failed(phaseCompress)
+					log.Println("error in compress backup", err)
+				} else {
+					w.stats.compressed(time.Since(start))
+				}
 			}
-			closeOnce.Do(func() { tmpBackupFile.Close() })
-			err = os.Remove(newBackUpFile + ".tmp")
-			if err != nil {
-				log.Println("error in remove tempfile", err)
-				return
+			// prune old backups if backups > MaxBackups
+			if c.MaxBackups > 0 {
+				if err := pruneBackups(c); err != nil {
+					w.stats.failed(phasePrune)
+				}
 			}
 		}
+		if w.compressor != nil {
+			w.compressor.submit(job)
+		} else {
+			go job()
+		}
+	}
+	return true, nil
+}
 
-		// TODO: prue files old backups if backups > MaxBackups
-	}()
+// reopen opens the file again after a failed rotation, the writes fail
+// until the next rotation if it can not be opened
+func (w *Writer) reopen(name string) {
+	file, err := w.fs.OpenFile(name, DefaultFileFlag, w.conf.FileMode)
+	if err != nil {
+		log.Println("error in reopen file", err)
+		return
+	}
+	w.file = file
+}
+
+// compressBackup replaces the backup file with its gzip compressed
+// version, the backup is left uncompressed if the compression fails. The
+// backup keeps its name until the compressed file replaces it, so that
+// the following rotations can not pick it
+func compressBackup(fs FileSystem, newBackUpFile string, fileMode os.FileMode) error {
+	tmpName := newBackUpFile + ".tmp"
+	backupFile, err := fs.OpenFile(newBackUpFile, os.O_RDONLY, fileMode)
+	if err != nil {
+		return err
+	}
+	err = compressFile(fs, backupFile, tmpName, fileMode)
+	backupFile.Close()
+	if err != nil {
+		return err
+	}
+	if err = fs.Rename(tmpName, newBackUpFile); err != nil {
+		if errR := fs.Remove(tmpName); errR != nil {
+			return errors.Join(err, errR)
+		}
+		return err
+	}
 	return nil
 }
 
+// FilePath returns the path of the log file
+func (w *Writer) FilePath() string {
+	return w.conf.FilePath
+}
+
+// ackPool recycles the acknowledgement channels of the synchronous writes
+var ackPool = sync.Pool{New: func() any { return make(chan error, 1) }}
+
+// Write enqueues the message, under Synchronous it returns once the message
+// is written to the file. It returns ErrClosed once the writer is closed
 func (w *Writer) Write(b []byte) (int, error) {
-	w.writeCh <- b
+	if w.conf.Synchronous {
+		return w.WriteContext(context.Background(), b)
+	}
+	if !w.queue.push(b, nil) {
+		return 0, ErrClosed
+	}
 	return len(b), nil
 }
 
-// Close the file and return
-func (w *Writer) Close() error {
-	defer recover()
-	w.errorCh <- nil
+// WriteContext writes the message like Write, it gives up with the error of
+// ctx if ctx is done while waiting for room in the queue or, under
+// Synchronous, for the message to be written. The message may still be
+// written once it was queued. It returns ErrClosed once the writer is closed
+func (w *Writer) WriteContext(ctx context.Context, b []byte) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	var done chan error
+	if w.conf.Synchronous {
+		done = ackPool.Get().(chan error)
+	}
+	if err := w.queue.pushContext(ctx, b, done); err != nil {
+		if done != nil {
+			ackPool.Put(done)
+		}
+		return 0, err
+	}
+	if done == nil {
+		return len(b), nil
+	}
+
 	select {
-	case <-w.errorCh:
-	case <-time.After(4 * time.Second):
+	case err := <-done:
+		ackPool.Put(done)
+		if err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	case <-ctx.Done():
+		// the acknowledgement is dropped, done is buffered for it
+		return 0, ctx.Err()
+	case <-w.ctx.Done():
+		// the writer go routines are gone, the message was not written
+		return 0, ErrClosed
 	}
-	w.monitor.Close()
+}
+
+// Sync writes the queued messages to the file and commits it to stable
+// storage, it returns after the messages written before Sync was called
+// are synced
+func (w *Writer) Sync() error {
+	done := make(chan error, 1)
+	select {
+	case w.syncCh <- done:
+	case <-w.ctx.Done():
+		return ErrClosed
+	}
+	return <-done
+}
+
+// Close writes the queued messages, closes the file and returns, closing
+// an already closed writer is a no-op. The writes, syncs and rotations
+// still waiting, or called afterwards, fail with ErrClosed
+func (w *Writer) Close() error {
+	w.closeOnce.Do(func() {
+		w.errorCh <- nil
+		select {
+		case <-w.stopped:
+		case <-time.After(4 * time.Second):
+		}
+		// the messages queued after the writer go routines stopped are lost
+		w.queue.close()
+		w.stats.dropped.Add(uint64(w.queue.len()) + uint64(w.held.Load()))
+		w.cancel()
+		w.monitor.Close()
+	})
 	return nil
 }
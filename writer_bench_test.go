@@ -2,8 +2,12 @@ package rollingwriter
 
 import (
 	"crypto/rand"
+	"fmt"
 	"io"
+	"os"
+	"sync"
 	"testing"
+	"time"
 )
 
 func BenchmarkWrite(b *testing.B) {
@@ -38,3 +42,120 @@ func BenchmarkParallelWrite(b *testing.B) {
 	clean()
 }
 
+// BenchmarkWriteGoroutines measures the Write throughput of concurrent
+// producers, the file writes are discarded so the queue is measured
+func BenchmarkWriteGoroutines(b *testing.B) {
+	for _, goroutines := range []int{1, 8, 64} {
+		for _, size := range []int{64, 1024, 16 * 1024} {
+			b.Run(fmt.Sprintf("goroutines=%d/size=%d", goroutines, size), func(b *testing.B) {
+				benchmarkWrite(b, goroutines, size)
+			})
+		}
+	}
+}
+
+func benchmarkWrite(b *testing.B, goroutines, size int) {
+	bf := make([]byte, size)
+	rand.Read(bf)
+	w, _ := NewWriter(WithFilePath("/bench/app.log"), WithFileSystem(discardFS{}))
+
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.ResetTimer()
+	var wg sync.WaitGroup
+	for g := range goroutines {
+		n := b.N / goroutines
+		if g < b.N%goroutines {
+			n++
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range n {
+				w.Write(bf)
+			}
+		}()
+	}
+	wg.Wait()
+	w.Close()
+}
+
+// discardFS is a FileSystem discarding the writes
+type discardFS struct{}
+
+func (discardFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return discardFile{}, nil
+}
+func (discardFS) Rename(oldpath, newpath string) error         { return nil }
+func (discardFS) Remove(name string) error                     { return nil }
+func (discardFS) MkdirAll(path string, perm os.FileMode) error { return nil }
+func (discardFS) Stat(name string) (os.FileInfo, error)        { return nil, os.ErrNotExist }
+func (discardFS) ReadDir(name string) ([]os.DirEntry, error)   { return nil, nil }
+
+type discardFile struct{}
+
+func (discardFile) Read(b []byte) (int, error)                   { return 0, io.EOF }
+func (discardFile) Write(b []byte) (int, error)                  { return len(b), nil }
+func (discardFile) Seek(offset int64, whence int) (int64, error) { return 0, nil }
+func (discardFile) Close() error                                 { return nil }
+func (discardFile) Sync() error                                  { return nil }
+func (discardFile) Stat() (os.FileInfo, error)                   { return discardInfo{}, nil }
+
+type discardInfo struct{}
+
+func (discardInfo) Name() string       { return "discard" }
+func (discardInfo) Size() int64        { return 0 }
+func (discardInfo) Mode() os.FileMode  { return 0 }
+func (discardInfo) ModTime() time.Time { return time.Time{} }
+func (discardInfo) IsDir() bool        { return false }
+func (discardInfo) Sys() any           { return nil }
+
+// BenchmarkFlush compares gathering a batch of messages into one vectored
+// write against copying them all into the buffer first
+func BenchmarkFlush(b *testing.B) {
+	for _, size := range []int{64, 1024, 16 * 1024} {
+		for _, mode := range []string{"gather", "copy"} {
+			b.Run(fmt.Sprintf("size=%d/%s", size, mode), func(b *testing.B) {
+				benchmarkFlush(b, size, mode == "gather")
+			})
+		}
+	}
+}
+
+func benchmarkFlush(b *testing.B, size int, vectored bool) {
+	cfg := NewDefaultConfig()
+	cfg.FilePath = b.TempDir() + "/bench.log"
+	w, _ := createWriter(&cfg, nil, nil)
+	w.openFile()
+	defer w.monitor.Close()
+	defer w.closeFile()
+
+	// one buffer size worth of messages per flush
+	bufs := make([][]byte, max(1, min(maxIovecs, cfg.BufferSize/size)))
+	for i := range bufs {
+		bufs[i] = make([]byte, size)
+		rand.Read(bufs[i])
+	}
+	batch := make([][]byte, len(bufs))
+
+	b.SetBytes(int64(len(bufs) * size))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := range b.N {
+		if vectored {
+			for _, data := range bufs {
+				w.bufferWrite(data)
+			}
+			w.flush()
+		} else {
+			copy(batch, bufs)
+			if _, err := w.writeCopy(batch); err != nil {
+				b.Fatal(err)
+			}
+		}
+		// keep the file in the page cache
+		if i%64 == 63 {
+			w.file.(*os.File).Truncate(0)
+		}
+	}
+}
@@ -1,10 +1,20 @@
 package rollingwriter
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
 	"crypto/rand"
+	"errors"
 	"io"
 	"os"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func clean() {
@@ -23,13 +33,20 @@ func newWriter() *Writer {
 
 func newVolumeWriter() *Writer {
 	cfg := NewDefaultConfig()
-	cfg.RollingPolicy = 3
+	cfg.RollingPolicy = VolumeRolling
 	cfg.RollingVolumeSize = "1mb"
 	cfg.FilePath = "./test/unittest.log"
 	w, _ := NewWriterFromConfig(&cfg)
 	return w.(*Writer)
 }
 
+// newClockWriter returns a running writer on a fake clock
+func newClockWriter(clock *FakeClock, ops ...Option) *Writer {
+	ops = append([]Option{WithFilePath("./test/unittest.log"), WithClock(clock)}, ops...)
+	w, _ := NewWriter(ops...)
+	return w.(*Writer)
+}
+
 func TestNewWriter(t *testing.T) {
 	if _, err := NewWriter(
 		WithTimeTagFormat("200601021504"), WithFilePath("./foo.log"),
@@ -111,18 +128,31 @@ func TestRotateFile(t *testing.T) {
 	c := 1000
 	l := 1024
 
-	t.Run("none", func(t *testing.T) {
-		t.Parallel()
-		writer := newWriter()
-		for range c {
-			bf := make([]byte, l)
-			rand.Read(bf)
-			writer.Write(bf)
-		}
-		writer.RotateFile("./test/unittest.reopen")
-		writer.Close()
-		clean()
-	})
+	cfg := NewDefaultConfig()
+	cfg.FilePath = "./test/unittest.log"
+	cfg.TimeTagFormat = "200601021504"
+	clock := NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local))
+	WithClock(clock)(&cfg)
+	w, _ := NewWriterFromConfig(&cfg)
+	writer := w.(*Writer)
+	for range c {
+		bf := make([]byte, l)
+		rand.Read(bf)
+		writer.Write(bf)
+	}
+
+	// the backup is tagged with the time the file was opened
+	clock.Advance(time.Hour)
+	backup, err := writer.Rotate(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "test/unittest.log.202401011200", backup)
+	info, _ := os.Stat(backup)
+	assert.Equal(t, int64(c*l), info.Size())
+	info, _ = os.Stat(cfg.FilePath)
+	assert.Equal(t, int64(0), info.Size())
+	writer.Close()
+	os.Remove(backup)
+	clean()
 }
 
 func TestAutoRemove(t *testing.T) {
@@ -154,3 +184,733 @@ func TestCompress(t *testing.T) {
 	writer.Close()
 	clean()
 }
+
+func TestSync(t *testing.T) {
+	writer := newWriter()
+	writer.Write([]byte("hello\n"))
+	assert.Nil(t, writer.Sync())
+	b, _ := os.ReadFile("./test/unittest.log")
+	assert.Equal(t, "hello\n", string(b))
+	writer.Close()
+	assert.Equal(t, ErrClosed, writer.Sync())
+	clean()
+}
+
+func TestSyncFaults(t *testing.T) {
+	mem := NewMemFS()
+	faults := NewFaultFS(mem)
+	w, err := NewWriter(WithFileSystem(faults), WithFilePath("/logs/app.log"))
+	assert.Nil(t, err)
+
+	// the failed write fails the next sync only
+	faults.Inject(Fault{Op: OpWrite, Err: syscall.ENOSPC, Times: 1})
+	w.Write([]byte("lost\n"))
+	assert.True(t, errors.Is(w.(*Writer).Sync(), syscall.ENOSPC))
+	w.Write([]byte("hello\n"))
+	assert.Nil(t, w.(*Writer).Sync())
+	b, _ := mem.ReadFile("/logs/app.log")
+	assert.Equal(t, "hello\n", string(b))
+
+	faults.Inject(Fault{Op: OpSync, Err: syscall.EIO, Times: 1})
+	assert.True(t, errors.Is(w.(*Writer).Sync(), syscall.EIO))
+	w.Close()
+}
+
+func TestRotate(t *testing.T) {
+	writer := newWriter()
+	writer.Write([]byte("hello\n"))
+	backup, err := writer.Rotate(context.Background())
+	assert.Nil(t, err)
+	writer.Write([]byte("world\n"))
+	writer.Sync()
+
+	b, _ := os.ReadFile(backup)
+	assert.Equal(t, "hello\n", string(b))
+	b, _ = os.ReadFile("./test/unittest.log")
+	assert.Equal(t, "world\n", string(b))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = writer.Rotate(ctx)
+	assert.Equal(t, context.Canceled, err)
+
+	writer.Close()
+	_, err = writer.Rotate(context.Background())
+	assert.Equal(t, ErrClosed, err)
+	os.Remove(backup)
+	clean()
+}
+
+func TestRecordRolling(t *testing.T) {
+	cfg := NewDefaultConfig()
+	cfg.FilePath = "./test/unittest.log"
+	WithRollingRecords(3)(&cfg)
+	os.MkdirAll("./test", 0700)
+	os.WriteFile(cfg.FilePath, []byte("old\n"), 0644)
+	w, _ := NewWriterFromConfig(&cfg)
+	writer := w.(*Writer)
+	events, _ := writer.Subscribe(4)
+
+	writer.Write([]byte("a\nb\n"))
+	writer.Write([]byte("c\nd\ne\nf\n"))
+	writer.Write([]byte("g\n"))
+	writer.Sync()
+
+	// the records are split over the files, the first file had one already
+	var backups []string
+	for range 2 {
+		event := <-events
+		assert.Equal(t, RotationRecords, event.Reason)
+		b, _ := os.ReadFile(event.BackupPath)
+		backups = append(backups, string(b))
+		os.Remove(event.BackupPath)
+	}
+	assert.Equal(t, []string{"old\na\nb\n", "c\nd\ne\n"}, backups)
+	b, _ := os.ReadFile(cfg.FilePath)
+	assert.Equal(t, "f\ng\n", string(b))
+	writer.Close()
+	clean()
+}
+
+// slowReadFS is a FileSystem delaying the opens for reading, which are
+// only done by the compression
+type slowReadFS struct {
+	FileSystem
+}
+
+func (fs slowReadFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if flag == os.O_RDONLY {
+		time.Sleep(time.Millisecond)
+	}
+	return fs.FileSystem.OpenFile(name, flag, perm)
+}
+
+func TestRecordRollingCompress(t *testing.T) {
+	mem := NewMemFS()
+	w, _ := NewWriter(
+		WithFileSystem(slowReadFS{mem}),
+		WithClock(NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local))),
+		WithFilePath("/logs/app.log"),
+		WithRollingRecords(1),
+		WithCompress(),
+	)
+	writer := w.(*Writer)
+
+	// every rotation falls in the same time tag while the previous backups
+	// are still being compressed
+	records := 200
+	for range records {
+		writer.Write([]byte("rec\n"))
+	}
+	writer.Close()
+
+	// each backup holds one record compressed once
+	backups := func() (int, bool) {
+		entries, _ := mem.ReadDir("/logs")
+		n := 0
+		for _, entry := range entries {
+			b, _ := mem.ReadFile("/logs/" + entry.Name())
+			if entry.Name() == "app.log" {
+				n += strings.Count(string(b), "rec\n")
+				continue
+			}
+			gr, err := gzip.NewReader(bytes.NewReader(b))
+			if err != nil {
+				return 0, false
+			}
+			gr.Multistream(false)
+			data, err := io.ReadAll(gr)
+			if err != nil || string(data) != "rec\n" {
+				return 0, false
+			}
+			n++
+		}
+		return n, true
+	}
+	assert.Eventually(t, func() bool {
+		_, ok := backups()
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+	n, _ := backups()
+	assert.Equal(t, records, n)
+}
+
+func TestRecordRollingFaults(t *testing.T) {
+	cfg := NewDefaultConfig()
+	cfg.FilePath = "/logs/app.log"
+	cfg.RollingPolicy = RecordRolling
+	_, err := createWriter(&cfg, nil, nil)
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+
+	mem := NewMemFS()
+	faults := NewFaultFS(mem)
+	mem.MkdirAll("/logs", 0700)
+	file, _ := mem.OpenFile(cfg.FilePath, DefaultFileFlag, 0644)
+	file.Write([]byte("1\n2\n3\n4\n"))
+	file.Close()
+	WithRollingRecords(3)(&cfg)
+	WithFileSystem(faults)(&cfg)
+	WithClock(NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)))(&cfg)
+
+	// the catch up rotation fails, the next record rotates the file
+	faults.Inject(Fault{Op: OpRename, Err: syscall.EXDEV, Times: 1})
+	writer, _ := createWriter(&cfg, nil, nil)
+	assert.Nil(t, writer.openFile())
+	writer.process([]byte("5\n6\n"))
+	writer.flush()
+	entries, _ := mem.ReadDir("/logs")
+	assert.Equal(t, 2, len(entries))
+	for _, entry := range entries {
+		if entry.Name() != "app.log" {
+			b, _ := mem.ReadFile("/logs/" + entry.Name())
+			assert.Equal(t, "1\n2\n3\n4\n5\n", string(b))
+		}
+	}
+	b, _ := mem.ReadFile(cfg.FilePath)
+	assert.Equal(t, "6\n", string(b))
+	writer.closeFile()
+	writer.monitor.Close()
+}
+
+func TestAgeAndIdleRotation(t *testing.T) {
+	cfg := NewDefaultConfig()
+	cfg.FilePath = "./test/unittest.log"
+	WithMaxAge(time.Hour)(&cfg)
+	WithIdleTimeout(time.Minute)(&cfg)
+	clock := NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local))
+	WithClock(clock)(&cfg)
+	// driven without the writer go routine
+	writer, err := createWriter(&cfg, nil, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, writer.openFile())
+	events, _ := writer.Subscribe(4)
+
+	// empty files are not rotated, the age starts over
+	clock.Advance(2 * time.Hour)
+	writer.tick(clock.Now())
+	assert.Equal(t, 0, len(events))
+	assert.Equal(t, clock.Now(), writer.startAt)
+
+	writer.process([]byte("hello\n"))
+	clock.Advance(time.Second)
+	writer.tick(clock.Now())
+	assert.Equal(t, 0, len(events))
+	clock.Advance(time.Minute)
+	writer.tick(clock.Now())
+	event := <-events
+	assert.Equal(t, RotationIdle, event.Reason)
+	assert.Equal(t, int64(6), event.Bytes)
+	assert.Equal(t, clock.Now(), event.TriggeredAt)
+	os.Remove(event.BackupPath)
+
+	writer.process([]byte("hello\n"))
+	clock.Advance(time.Hour)
+	writer.tick(clock.Now())
+	event = <-events
+	assert.Equal(t, RotationAge, event.Reason)
+	os.Remove(event.BackupPath)
+
+	writer.closeFile()
+	writer.monitor.Close()
+
+	cfg.MaxAge = "1 day"
+	_, err = createWriter(&cfg, nil, nil)
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+	clean()
+}
+
+func TestBackupTimeTag(t *testing.T) {
+	cfg := NewDefaultConfig()
+	cfg.FilePath = "./test/unittest.log"
+	cfg.TimeTagFormat = "2006-01-02T15:04:05"
+	WithBackupTimeTag(TagWriteRange)(&cfg)
+	clock := NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local))
+	WithClock(clock)(&cfg)
+	writer, _ := createWriter(&cfg, nil, nil)
+	writer.openFile()
+
+	first := clock.Now()
+	writer.process([]byte("first\n"))
+	clock.Advance(time.Minute)
+	last := clock.Now()
+	writer.process([]byte("last\n"))
+	backup, err := writer.rotate(RotationTrigger{Reason: RotationManual})
+	assert.Nil(t, err)
+	assert.Equal(t, "test/unittest.log."+first.Format(cfg.TimeTagFormat)+"-"+last.Format(cfg.TimeTagFormat), backup)
+
+	// the retention finds the range tagged backups
+	backups, _ := listBackups(&cfg)
+	assert.Equal(t, 1, len(backups))
+	assert.Equal(t, first, backups[0].at)
+
+	// empty files are tagged with their start time
+	clock.Advance(time.Minute)
+	backup, _ = writer.rotate(RotationTrigger{Reason: RotationManual})
+	assert.Equal(t, "test/unittest.log."+last.Format(cfg.TimeTagFormat), backup)
+	writer.closeFile()
+	writer.monitor.Close()
+	os.RemoveAll("./test")
+}
+
+func TestCatchUpRotation(t *testing.T) {
+	cfg := NewDefaultConfig()
+	cfg.FilePath = "./test/unittest.log"
+	clock := NewFakeClock(time.Date(2024, 1, 2, 12, 0, 0, 0, time.Local))
+	WithClock(clock)(&cfg)
+	os.MkdirAll("./test", 0700)
+	os.WriteFile(cfg.FilePath, []byte("yesterday\n"), 0644)
+	yesterday := clock.Now().Add(-24 * time.Hour)
+	os.Chtimes(cfg.FilePath, yesterday, yesterday)
+
+	// the daily rotation was missed, the file is rotated first
+	writer, _ := createWriter(&cfg, nil, nil)
+	events, _ := writer.Subscribe(1)
+	writer.openFile()
+	event := <-events
+	assert.Equal(t, RotationTime, event.Reason)
+	assert.Equal(t, "test/unittest.log."+yesterday.Format(cfg.TimeTagFormat), event.BackupPath)
+	writer.closeFile()
+	writer.monitor.Close()
+	os.Remove(event.BackupPath)
+
+	// a recent file is reopened
+	os.WriteFile(cfg.FilePath, []byte("today\n"), 0644)
+	os.Chtimes(cfg.FilePath, clock.Now(), clock.Now())
+	writer, _ = createWriter(&cfg, nil, nil)
+	events, _ = writer.Subscribe(1)
+	writer.openFile()
+	assert.Equal(t, 0, len(events))
+	writer.closeFile()
+	writer.monitor.Close()
+
+	cfg.RollingPolicy = VolumeRolling
+	cfg.RollingVolumeSize = "1kb"
+	os.WriteFile(cfg.FilePath, make([]byte, 2048), 0644)
+	writer, _ = createWriter(&cfg, nil, nil)
+	events, _ = writer.Subscribe(1)
+	writer.openFile()
+	event = <-events
+	assert.Equal(t, RotationSize, event.Reason)
+	assert.Equal(t, int64(2048), event.Bytes)
+	writer.closeFile()
+	writer.monitor.Close()
+	os.RemoveAll("./test")
+}
+
+func TestTimeRolling(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 23, 59, 0, 0, time.Local))
+	writer := newClockWriter(clock, WithRollingTimePattern("0 0 0 * * *"))
+	events, _ := writer.Subscribe(1)
+
+	writer.Write([]byte("hello\n"))
+	writer.Sync()
+	// the flush ticker and the scheduler wait on the clock
+	clock.BlockUntil(2)
+	clock.Advance(2 * time.Minute)
+
+	event := <-events
+	assert.Equal(t, RotationTime, event.Reason)
+	assert.Equal(t, "test/unittest.log.202401012359", event.BackupPath)
+	assert.Equal(t, time.Date(2024, 1, 1, 23, 59, 0, 0, time.Local), event.StartTime)
+	b, _ := os.ReadFile(event.BackupPath)
+	assert.Equal(t, "hello\n", string(b))
+	writer.Close()
+	os.RemoveAll("./test")
+}
+
+func TestVolumeRolling(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local))
+	writer := newClockWriter(clock, WithRollingVolumeSize("1kb"))
+	events, _ := writer.Subscribe(1)
+
+	writer.Write(make([]byte, 2048))
+	writer.Sync()
+	clock.BlockUntil(2)
+	clock.Advance(time.Duration(Precision) * time.Second)
+
+	event := <-events
+	assert.Equal(t, RotationSize, event.Reason)
+	assert.Equal(t, int64(2048), event.Bytes)
+	assert.Equal(t, clock.Now(), event.TriggeredAt)
+	writer.Close()
+	os.RemoveAll("./test")
+}
+
+func TestRotateFaults(t *testing.T) {
+	mem := NewMemFS()
+	faults := NewFaultFS(mem)
+	cfg := NewDefaultConfig()
+	cfg.FilePath = "/logs/app.log"
+	WithFileSystem(faults)(&cfg)
+	WithClock(NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)))(&cfg)
+
+	faults.Inject(Fault{Op: OpMkdirAll, Err: syscall.EACCES, Times: 1})
+	writer, _ := createWriter(&cfg, nil, nil)
+	assert.True(t, errors.Is(writer.openFile(), syscall.EACCES))
+	assert.Nil(t, writer.openFile())
+
+	// the file is kept if it can not be renamed
+	writer.process([]byte("a\n"))
+	faults.Inject(Fault{Op: OpRename, Err: syscall.EXDEV, Times: 1})
+	_, err := writer.rotate(RotationTrigger{Reason: RotationManual})
+	assert.True(t, errors.Is(err, syscall.EXDEV))
+	writer.process([]byte("b\n"))
+	writer.flush()
+	b, _ := mem.ReadFile("/logs/app.log")
+	assert.Equal(t, "a\nb\n", string(b))
+
+	// the file is moved back if the new file can not be opened
+	faults.Inject(Fault{Op: OpOpen, Path: "app.log", Err: syscall.ENOSPC, Times: 1})
+	_, err = writer.rotate(RotationTrigger{Reason: RotationManual})
+	assert.True(t, errors.Is(err, syscall.ENOSPC))
+	writer.process([]byte("c\n"))
+	writer.flush()
+	b, _ = mem.ReadFile("/logs/app.log")
+	assert.Equal(t, "a\nb\nc\n", string(b))
+
+	backup, err := writer.rotate(RotationTrigger{Reason: RotationManual})
+	assert.Nil(t, err)
+	assert.Equal(t, "/logs/app.log.202401011200", backup)
+	b, _ = mem.ReadFile(backup)
+	assert.Equal(t, "a\nb\nc\n", string(b))
+
+	// the failed writes are counted
+	faults.Inject(Fault{Op: OpWrite, Err: syscall.ENOSPC, Times: 1})
+	writer.process([]byte("d\n"))
+	writer.flush()
+	assert.Equal(t, uint64(3), writer.Stats().Errors)
+	writer.closeFile()
+	writer.monitor.Close()
+}
+
+func TestCompressFaults(t *testing.T) {
+	mem := NewMemFS()
+	faults := NewFaultFS(mem)
+	mem.MkdirAll("/logs", 0700)
+	file, _ := mem.OpenFile("/logs/app.log.gz.1", DefaultFileFlag, 0644)
+	file.Write([]byte("hello\n"))
+	file.Close()
+
+	// the backup is left uncompressed on failures
+	for _, fault := range []Fault{
+		{Op: OpRename, Err: syscall.EXDEV},
+		{Op: OpOpen, Path: "*.tmp", Err: syscall.EACCES},
+		{Op: OpRead, Err: syscall.EIO},
+		{Op: OpOpen, Path: "app.log.gz.1", Err: syscall.ENOSPC},
+		{Op: OpWrite, Path: "*.tmp", Err: syscall.ENOSPC},
+	} {
+		faults.Clear()
+		faults.Inject(fault)
+		err := compressBackup(faults, "/logs/app.log.gz.1", 0644)
+		assert.True(t, errors.Is(err, fault.Err), fault.Op)
+		b, _ := mem.ReadFile("/logs/app.log.gz.1")
+		assert.Equal(t, "hello\n", string(b), fault.Op)
+		entries, _ := mem.ReadDir("/logs")
+		assert.Equal(t, 1, len(entries), fault.Op)
+	}
+
+	faults.Clear()
+	assert.Nil(t, compressBackup(faults, "/logs/app.log.gz.1", 0644))
+	b, _ := mem.ReadFile("/logs/app.log.gz.1")
+	gr, err := gzip.NewReader(bytes.NewReader(b))
+	assert.Nil(t, err)
+	b, _ = io.ReadAll(gr)
+	assert.Equal(t, "hello\n", string(b))
+	entries, _ := mem.ReadDir("/logs")
+	assert.Equal(t, 1, len(entries))
+}
+
+func TestWriteBuffers(t *testing.T) {
+	cfg := NewDefaultConfig()
+	cfg.FilePath = "./test/unittest.log"
+	writer, _ := createWriter(&cfg, nil, nil)
+	assert.Nil(t, writer.openFile())
+
+	// more buffers than a single writev takes, empty ones included
+	var bufs [][]byte
+	var want []byte
+	for i := range 2*maxIovecs + 10 {
+		b := bytes.Repeat([]byte{byte('a' + i%26)}, i%7)
+		bufs = append(bufs, b)
+		want = append(want, b...)
+	}
+	big := make([]byte, 256*1024)
+	rand.Read(big)
+	bufs = append(bufs, big)
+	want = append(want, big...)
+
+	n, err := writer.writeBuffers(bufs)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(want)), n)
+	b, _ := os.ReadFile(cfg.FilePath)
+	assert.Equal(t, want, b)
+
+	// the writes fail on a closed file
+	writer.file.Close()
+	_, err = writer.writeBuffers([][]byte{[]byte("closed\n")})
+	assert.NotNil(t, err)
+	writer.monitor.Close()
+	clean()
+}
+
+func TestConsumeBuffers(t *testing.T) {
+	bufs := [][]byte{[]byte("ab"), nil, []byte("cde"), []byte("f")}
+	assert.Equal(t, [][]byte{[]byte("de"), []byte("f")}, consumeBuffers(bufs, 3))
+	assert.Equal(t, 0, len(consumeBuffers([][]byte{[]byte("ab"), nil}, 2)))
+}
+
+// stallFS is a FileSystem whose file writes or syncs block until gate is
+// closed
+type stallFS struct {
+	FileSystem
+	op      FSOp
+	gate    chan struct{}
+	stalled chan struct{}
+}
+
+func (fs stallFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	file, err := fs.FileSystem.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return stallFile{file, fs}, nil
+}
+
+type stallFile struct {
+	File
+	fs stallFS
+}
+
+func (f stallFile) Write(b []byte) (int, error) {
+	f.stall(OpWrite)
+	return f.File.Write(b)
+}
+
+func (f stallFile) Sync() error {
+	f.stall(OpSync)
+	return f.File.Sync()
+}
+
+func (f stallFile) stall(op FSOp) {
+	if op != f.fs.op {
+		return
+	}
+	select {
+	case <-f.fs.gate:
+	default:
+		f.fs.stalled <- struct{}{}
+		<-f.fs.gate
+	}
+}
+
+func TestWriteWhileFileBlocked(t *testing.T) {
+	mem := NewMemFS()
+	fs := stallFS{mem, OpWrite, make(chan struct{}), make(chan struct{}, 1)}
+	cfg := NewDefaultConfig()
+	cfg.FilePath = "/logs/app.log"
+	cfg.QueueSize = MinQueueSize
+	cfg.BufferSize = MinBufferSize
+	WithFileSystem(fs)(&cfg)
+	w, _ := NewWriterFromConfig(&cfg)
+	writer := w.(*Writer)
+
+	// the big message is written at once and blocks the I/O go routine
+	big := append(bytes.Repeat([]byte{'x'}, MinBufferSize/2), '\n')
+	writer.Write(big)
+	<-fs.stalled
+
+	// the messages fill the batch and the queue without blocking
+	want := append([]byte{}, big...)
+	done := make(chan struct{})
+	go func() {
+		for i := range 2*MinQueueSize - 8 {
+			msg := []byte{byte('a' + i%26), '\n'}
+			want = append(want, msg...)
+			writer.Write(msg)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("write blocked on the file")
+	}
+	assert.Eventually(t, func() bool {
+		return writer.Stats().QueueDepth == 2*MinQueueSize-7
+	}, time.Second, time.Millisecond)
+
+	close(fs.gate)
+	writer.Close()
+	b, _ := mem.ReadFile("/logs/app.log")
+	assert.Equal(t, want, b)
+}
+
+func TestSynchronousWrite(t *testing.T) {
+	mem := NewMemFS()
+	faults := NewFaultFS(mem)
+	w, _ := NewWriter(
+		WithFilePath("/logs/app.log"), WithFileSystem(faults),
+		WithClock(NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local))),
+		WithRollingRecords(10), WithSynchronous(true),
+	)
+	writer := w.(*Writer)
+
+	// the message is in the file once Write returns
+	for i := range 5 {
+		n, err := writer.Write([]byte("a\n"))
+		assert.Nil(t, err)
+		assert.Equal(t, 2, n)
+		b, _ := mem.ReadFile("/logs/app.log")
+		assert.Equal(t, 2*(i+1), len(b))
+	}
+
+	// the write and sync errors are returned to the caller
+	faults.Inject(Fault{Op: OpWrite, Err: syscall.ENOSPC, Times: 1})
+	n, err := writer.Write([]byte("b\n"))
+	assert.True(t, errors.Is(err, syscall.ENOSPC))
+	assert.Equal(t, 0, n)
+	faults.Inject(Fault{Op: OpSync, Err: syscall.EIO, Times: 1})
+	_, err = writer.Write([]byte("c\n"))
+	assert.True(t, errors.Is(err, syscall.EIO))
+
+	// the concurrent writes go through the rotations
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				_, err := writer.Write([]byte("d\n"))
+				assert.Nil(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+	entries, _ := mem.ReadDir("/logs")
+	records := 0
+	for _, entry := range entries {
+		b, _ := mem.ReadFile("/logs/" + entry.Name())
+		records += strings.Count(string(b), "\n")
+	}
+	assert.Equal(t, 406, records)
+	assert.True(t, writer.Stats().Rotations >= 40)
+
+	writer.Close()
+	_, err = writer.Write([]byte("e\n"))
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestGroupCommit(t *testing.T) {
+	mem := NewMemFS()
+	fs := stallFS{mem, OpSync, make(chan struct{}), make(chan struct{}, 1)}
+	w, _ := NewWriter(WithFilePath("/logs/app.log"), WithFileSystem(fs), WithoutRollingPolicy(), WithGroupCommit())
+	writer := w.(*Writer)
+
+	// the first write blocks the I/O go routine in its fsync
+	first := make(chan error, 1)
+	go func() {
+		_, err := writer.Write([]byte("first\n"))
+		first <- err
+	}()
+	<-fs.stalled
+
+	// the writes arriving meanwhile are committed by the next fsync
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := writer.Write([]byte("next\n"))
+			assert.Nil(t, err)
+		}()
+	}
+	assert.Eventually(t, func() bool {
+		return writer.Stats().QueueDepth == 21
+	}, time.Second, time.Millisecond)
+	close(fs.gate)
+	wg.Wait()
+	assert.Nil(t, <-first)
+
+	stats := writer.Stats()
+	assert.Equal(t, uint64(2), stats.Commits)
+	assert.Equal(t, uint64(21), stats.CommittedRecords)
+	assert.Equal(t, uint64(20), stats.MaxCommitRecords)
+	assert.True(t, stats.MaxCommitTime > 0)
+	assert.True(t, stats.CommitTime >= stats.MaxCommitTime)
+	b, _ := mem.ReadFile("/logs/app.log")
+	assert.Equal(t, "first\n"+strings.Repeat("next\n", 20), string(b))
+	writer.Close()
+}
+
+func TestWriteContext(t *testing.T) {
+	mem := NewMemFS()
+	fs := stallFS{mem, OpWrite, make(chan struct{}), make(chan struct{}, 1)}
+	cfg := NewDefaultConfig()
+	cfg.FilePath = "/logs/app.log"
+	cfg.QueueSize = MinQueueSize
+	cfg.BufferSize = MinBufferSize
+	WithFileSystem(fs)(&cfg)
+	w, _ := NewWriterFromConfig(&cfg)
+	writer := w.(*Writer)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := writer.WriteContext(ctx, []byte("a\n"))
+	assert.Equal(t, context.Canceled, err)
+
+	// the batch and the queue fill up while the file is blocked
+	writer.Write(append(bytes.Repeat([]byte{'x'}, MinBufferSize/2), '\n'))
+	<-fs.stalled
+	written := 0
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		_, err = writer.WriteContext(ctx, []byte("b\n"))
+		cancel()
+		if err != nil {
+			break
+		}
+		written++
+	}
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 2*MinQueueSize, written)
+
+	// the writes waiting for room go on once the file is written
+	done := make(chan error, 1)
+	go func() {
+		_, err := writer.WriteContext(context.Background(), []byte("c\n"))
+		done <- err
+	}()
+	close(fs.gate)
+	assert.Nil(t, <-done)
+
+	writer.Close()
+	_, err = writer.Write([]byte("d\n"))
+	assert.Equal(t, ErrClosed, err)
+	_, err = writer.WriteContext(context.Background(), []byte("d\n"))
+	assert.Equal(t, ErrClosed, err)
+	assert.Equal(t, ErrClosed, writer.Sync())
+	b, _ := mem.ReadFile("/logs/app.log")
+	assert.Equal(t, MinBufferSize/2+1+2*written+2, len(b))
+}
+
+func TestSynchronousWriteContext(t *testing.T) {
+	mem := NewMemFS()
+	fs := stallFS{mem, OpSync, make(chan struct{}), make(chan struct{}, 1)}
+	w, _ := NewWriter(WithFilePath("/logs/app.log"), WithFileSystem(fs), WithoutRollingPolicy(), WithSynchronous(true))
+	writer := w.(*Writer)
+
+	// the deadline passes while the write waits for the fsync
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := writer.WriteContext(ctx, []byte("a\n"))
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// the message was queued, it is written anyway
+	close(fs.gate)
+	n, err := writer.WriteContext(context.Background(), []byte("b\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	b, _ := mem.ReadFile("/logs/app.log")
+	assert.Equal(t, "a\nb\n", string(b))
+	writer.Close()
+}
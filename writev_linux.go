@@ -0,0 +1,71 @@
+//go:build linux
+
+package rollingwriter
+
+import (
+	"io"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+type iovec = syscall.Iovec
+
+// writeBuffers writes the buffers to the file with writev system calls if
+// it is an os file, the buffers are not copied
+func (w *Writer) writeBuffers(bufs [][]byte) (int64, error) {
+	file, ok := w.file.(*os.File)
+	if !ok {
+		return w.writeCopy(bufs)
+	}
+	conn, err := file.SyscallConn()
+	if err != nil {
+		return w.writeCopy(bufs)
+	}
+
+	var written int64
+	var werr error
+	err = conn.Write(func(fd uintptr) bool {
+		for len(bufs) > 0 {
+			iovs := w.iovecs[:0]
+			for _, b := range bufs[:min(len(bufs), maxIovecs)] {
+				if len(b) == 0 {
+					continue
+				}
+				iov := syscall.Iovec{Base: &b[0]}
+				iov.SetLen(len(b))
+				iovs = append(iovs, iov)
+			}
+			w.iovecs = iovs
+			if len(iovs) == 0 {
+				return true
+			}
+
+			n, _, errno := syscall.Syscall(syscall.SYS_WRITEV, fd, uintptr(unsafe.Pointer(&iovs[0])), uintptr(len(iovs)))
+			clear(iovs)
+			switch {
+			case errno == syscall.EINTR:
+				continue
+			case errno == syscall.EAGAIN:
+				// wait for the file to be writable
+				return false
+			case errno != 0:
+				werr = os.NewSyscallError("writev", errno)
+				return true
+			case n == 0:
+				werr = io.ErrShortWrite
+				return true
+			}
+			written += int64(n)
+			bufs = consumeBuffers(bufs, int(n))
+		}
+		return true
+	})
+	if werr == nil && err != nil {
+		werr = err
+	}
+	if werr != nil {
+		werr = &os.PathError{Op: "write", Path: file.Name(), Err: werr}
+	}
+	return written, werr
+}
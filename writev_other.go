@@ -0,0 +1,11 @@
+//go:build !linux
+
+package rollingwriter
+
+type iovec struct{}
+
+// writeBuffers writes the buffers to the file with a single Write, the
+// vectored writes are only used on linux
+func (w *Writer) writeBuffers(bufs [][]byte) (int64, error) {
+	return w.writeCopy(bufs)
+}
@@ -0,0 +1,52 @@
+// Package zapadapter adapts the rolling writers to zapcore.WriteSyncer
+package zapadapter
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/nipuntalukdar/rollingwriter"
+	"go.uber.org/zap/zapcore"
+)
+
+// WriteSyncer is a zapcore.WriteSyncer writing to a rolling writer
+type WriteSyncer struct {
+	w rollingwriter.RollingWriter
+}
+
+var _ zapcore.WriteSyncer = (*WriteSyncer)(nil)
+
+// New generate the WriteSyncer writing to w
+func New(w rollingwriter.RollingWriter) *WriteSyncer {
+	return &WriteSyncer{w: w}
+}
+
+// NewFromConfig generate the WriteSyncer writing to a new rolling writer
+// with the given config
+func NewFromConfig(c *rollingwriter.Config) (*WriteSyncer, error) {
+	w, err := rollingwriter.NewWriterFromConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	return New(w), nil
+}
+
+// Write enqueues a copy of the entry, zap reuses its encoder buffers once
+// Write returns
+func (s *WriteSyncer) Write(b []byte) (int, error) {
+	return s.w.Write(bytes.Clone(b))
+}
+
+// Sync returns once the entries written so far are in stable storage, it
+// fails with errors.ErrUnsupported if the writer is not a Syncer
+func (s *WriteSyncer) Sync() error {
+	if syncer, ok := s.w.(rollingwriter.Syncer); ok {
+		return syncer.Sync()
+	}
+	return errors.ErrUnsupported
+}
+
+// Close closes the rolling writer
+func (s *WriteSyncer) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,60 @@
+package zapadapter
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/nipuntalukdar/rollingwriter"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestWriteSyncer(t *testing.T) {
+	cfg := rollingwriter.NewDefaultConfig()
+	cfg.FilePath = "./test/zap.log"
+	ws, err := NewFromConfig(&cfg)
+	assert.Nil(t, err)
+
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), ws, zap.InfoLevel)
+	logger := zap.New(core)
+	for i := range 100 {
+		logger.Info("hello", zap.Int("i", i))
+	}
+	// the entries are in the file as soon as Sync returns
+	assert.Nil(t, logger.Sync())
+	b, _ := os.ReadFile(cfg.FilePath)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	assert.Equal(t, 100, len(lines))
+	for _, line := range lines {
+		assert.Contains(t, line, `"msg":"hello"`)
+	}
+
+	assert.Nil(t, ws.Close())
+	assert.Equal(t, rollingwriter.ErrClosed, ws.Sync())
+	os.RemoveAll("./test")
+}
+
+// nopWriter is a RollingWriter which can not sync
+type nopWriter struct{}
+
+func (nopWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (nopWriter) Close() error                { return nil }
+
+func TestWriteSyncerTee(t *testing.T) {
+	cfg := rollingwriter.NewDefaultConfig()
+	cfg.FilePath = "./test/zap.log"
+	tee, err := rollingwriter.NewTeeWriter(rollingwriter.FileSink(&cfg))
+	assert.Nil(t, err)
+	ws := New(tee)
+	ws.Write([]byte("hello\n"))
+	assert.Nil(t, ws.Sync())
+	b, _ := os.ReadFile(cfg.FilePath)
+	assert.Equal(t, "hello\n", string(b))
+	assert.Nil(t, ws.Close())
+
+	assert.True(t, errors.Is(New(nopWriter{}).Sync(), errors.ErrUnsupported))
+	os.RemoveAll("./test")
+}
@@ -0,0 +1,23 @@
+module github.com/nipuntalukdar/rollingwriter/zerologadapter
+
+go 1.23.3
+
+require (
+	github.com/nipuntalukdar/rollingwriter v0.0.0-20261018182901-269e6f163b08
+	github.com/rs/zerolog v1.33.0
+	github.com/stretchr/testify v1.10.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/mattn/go-colorable v0.1.13 // indirect
+	github.com/mattn/go-isatty v0.0.19 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/robfig/cron v1.2.0 // indirect
+	golang.org/x/sys v0.22.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+// the replace builds against the working tree, it is ignored by the users
+// of the module who get the required version
+replace github.com/nipuntalukdar/rollingwriter => ../
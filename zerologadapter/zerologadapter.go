@@ -0,0 +1,96 @@
+// Package zerologadapter adapts the rolling writers to zerolog.LevelWriter
+package zerologadapter
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/nipuntalukdar/rollingwriter"
+	"github.com/rs/zerolog"
+)
+
+// LevelWriter is a zerolog.LevelWriter routing the events to rolling
+// writers by level
+type LevelWriter struct {
+	def    rollingwriter.RollingWriter
+	levels map[zerolog.Level]rollingwriter.RollingWriter
+}
+
+var _ zerolog.LevelWriter = (*LevelWriter)(nil)
+
+// New generate the LevelWriter writing all the events to w
+func New(w rollingwriter.RollingWriter) *LevelWriter {
+	return &LevelWriter{
+		def:    w,
+		levels: make(map[zerolog.Level]rollingwriter.RollingWriter),
+	}
+}
+
+// Route sends the events of the given levels to w instead of the default
+// writer, it must be called before the LevelWriter is used
+func (l *LevelWriter) Route(w rollingwriter.RollingWriter, levels ...zerolog.Level) *LevelWriter {
+	for _, level := range levels {
+		l.levels[level] = w
+	}
+	return l
+}
+
+// Write enqueues a copy of the event to the default writer, zerolog
+// reuses its event buffers once Write returns
+func (l *LevelWriter) Write(b []byte) (int, error) {
+	return l.def.Write(bytes.Clone(b))
+}
+
+// WriteLevel enqueues a copy of the event to the writer of its level
+func (l *LevelWriter) WriteLevel(level zerolog.Level, b []byte) (int, error) {
+	if w, ok := l.levels[level]; ok {
+		return w.Write(bytes.Clone(b))
+	}
+	return l.Write(b)
+}
+
+// Sync returns once the events written so far are in stable storage, it
+// fails with errors.ErrUnsupported for the writers which are not Syncers
+func (l *LevelWriter) Sync() error {
+	var errs []error
+	for _, w := range l.writers() {
+		syncer, ok := w.(rollingwriter.Syncer)
+		if !ok {
+			errs = append(errs, errors.ErrUnsupported)
+			continue
+		}
+		if err := syncer.Sync(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes all the rolling writers
+func (l *LevelWriter) Close() error {
+	var errs []error
+	for _, w := range l.writers() {
+		if err := w.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// writers returns the distinct rolling writers
+func (l *LevelWriter) writers() []rollingwriter.RollingWriter {
+	writers := []rollingwriter.RollingWriter{l.def}
+	for _, w := range l.levels {
+		found := false
+		for _, seen := range writers {
+			if seen == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			writers = append(writers, w)
+		}
+	}
+	return writers
+}
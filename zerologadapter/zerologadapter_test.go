@@ -0,0 +1,58 @@
+package zerologadapter
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/nipuntalukdar/rollingwriter"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevelWriter(t *testing.T) {
+	cfg := rollingwriter.NewDefaultConfig()
+	cfg.FilePath = "./test/app.log"
+	errCfg := rollingwriter.NewDefaultConfig()
+	errCfg.FilePath = "./test/error.log"
+	w, _ := rollingwriter.NewWriterFromConfig(&cfg)
+	errw, _ := rollingwriter.NewWriterFromConfig(&errCfg)
+
+	lw := New(w).Route(errw, zerolog.ErrorLevel, zerolog.FatalLevel)
+	logger := zerolog.New(lw)
+	for i := range 100 {
+		logger.Info().Int("i", i).Msg("hello")
+	}
+	logger.Error().Msg("failed")
+	assert.Nil(t, lw.Sync())
+
+	b, _ := os.ReadFile(cfg.FilePath)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	assert.Equal(t, 100, len(lines))
+	for _, line := range lines {
+		assert.Contains(t, line, `"message":"hello"`)
+	}
+	b, _ = os.ReadFile(errCfg.FilePath)
+	assert.Equal(t, `{"level":"error","message":"failed"}`+"\n", string(b))
+
+	assert.Nil(t, lw.Close())
+	os.RemoveAll("./test")
+}
+
+// nopWriter is a RollingWriter which can not sync
+type nopWriter struct{}
+
+func (nopWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (nopWriter) Close() error                { return nil }
+
+func TestLevelWriterSyncUnsupported(t *testing.T) {
+	cfg := rollingwriter.NewDefaultConfig()
+	cfg.FilePath = "./test/app.log"
+	w, _ := rollingwriter.NewWriterFromConfig(&cfg)
+
+	lw := New(w).Route(nopWriter{}, zerolog.ErrorLevel)
+	assert.True(t, errors.Is(lw.Sync(), errors.ErrUnsupported))
+	assert.Nil(t, lw.Close())
+	os.RemoveAll("./test")
+}